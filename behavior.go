@@ -1,6 +1,8 @@
-package main
+package knock
 
 import (
+	"context"
+	"sync"
 	"time"
 )
 
@@ -13,6 +15,20 @@ const (
 	WRK_ERROR
 )
 
+// The outcome of one unit of work, along with how many bytes it sent
+// and received, so that bandwidth can be reported next to throughput.
+// Behaviors which don't count bytes leave them at zero.
+type OpResult struct {
+	Status        WorkResult
+	RequestBytes  int64
+	ResponseBytes int64
+
+	// The type of operation (e.g. "insert" or "find"), for behaviors
+	// which mix them.  Each label gets its own statistics, on top of
+	// the combined ones.
+	Label string
+}
+
 type BehaviorFactory func() Behavior
 
 type Behavior interface {
@@ -25,3 +41,145 @@ type Behavior interface {
 	// Perform one unit of work.
 	Work(t0 time.Time) (res WorkResult)
 }
+
+// A Behavior which counts the bytes it transfers.  WorkSized is called
+// instead of Work.
+type SizedBehavior interface {
+	Behavior
+
+	WorkSized(t0 time.Time) (res OpResult)
+}
+
+type ContextBehaviorFactory func() ContextBehavior
+
+// A behavior which can be cancelled.  The context passed to Work is
+// done once the operation times out, or the run ends (or is
+// interrupted), and carries the operation's intended start time (see
+// IntendedStartTime).  A client's operations share their context, so
+// it mustn't be kept once Work returns.
+type ContextBehavior interface {
+	// Initialize any state for this client.
+	Init(ctx context.Context, props map[string]string) (err error)
+
+	// Cleanup any state for this client.
+	Close(ctx context.Context)
+
+	// Perform one unit of work.
+	Work(ctx context.Context) (res OpResult)
+}
+
+type intendedStartKey struct{}
+
+func withIntendedStartTime(ctx context.Context, t0 time.Time) context.Context {
+	return context.WithValue(ctx, intendedStartKey{}, t0)
+}
+
+// The context of a client's operations, which is derived once rather
+// than per operation.  It carries the intended start time of the
+// operation in flight and, when timed, is done once the operation's
+// timeout elapses, or the run ends.  Only one operation uses it at a
+// time; a timed out one keeps it, and the client moves on to another.
+type opContext struct {
+	context.Context
+	t0       time.Time
+	deadline time.Time
+	done     chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+func newOpContext(parent context.Context, timed bool) *opContext {
+	this := &opContext{Context: parent}
+	if timed {
+		this.done = make(chan struct{})
+	}
+
+	return this
+}
+
+func (this *opContext) Deadline() (deadline time.Time, ok bool) {
+	if this.done == nil {
+		return this.Context.Deadline()
+	}
+
+	return this.deadline, true
+}
+
+func (this *opContext) Done() <-chan struct{} {
+	if this.done == nil {
+		return this.Context.Done()
+	}
+
+	return this.done
+}
+
+func (this *opContext) Err() error {
+	if this.done == nil {
+		return this.Context.Err()
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.err
+}
+
+func (this *opContext) Value(key interface{}) interface{} {
+	if key == (intendedStartKey{}) {
+		return this.t0
+	}
+
+	return this.Context.Value(key)
+}
+
+// Ends the operation in flight.  It's up to the client to call this
+// once the timeout elapses, or the run ends.
+func (this *opContext) cancel(err error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.err == nil {
+		this.err = err
+		close(this.done)
+	}
+}
+
+// The time at which the current operation should have started.  In
+// a closed loop, that's when the client got round to it; in an open
+// loop, it's whenever the scheduler said so.
+func IntendedStartTime(ctx context.Context) (t0 time.Time) {
+	t0, _ = ctx.Value(intendedStartKey{}).(time.Time)
+	return
+}
+
+// Adapts a factory of Behaviors, which can't be cancelled, into one
+// of ContextBehaviors.
+func Adapt(factory BehaviorFactory) ContextBehaviorFactory {
+	return func() ContextBehavior {
+		return &behaviorAdapter{factory()}
+	}
+}
+
+type behaviorAdapter struct {
+	b Behavior
+}
+
+func (this *behaviorAdapter) Init(ctx context.Context, props map[string]string) (err error) {
+	if eb, ok := this.b.(EnvBehavior); ok {
+		return eb.InitEnv(EnvOf(ctx), props)
+	}
+
+	return this.b.Init(props)
+}
+
+func (this *behaviorAdapter) Close(ctx context.Context) {
+	this.b.Close()
+}
+
+func (this *behaviorAdapter) Work(ctx context.Context) (res OpResult) {
+	if sb, ok := this.b.(SizedBehavior); ok {
+		return sb.WorkSized(IntendedStartTime(ctx))
+	}
+
+	return OpResult{Status: this.b.Work(IntendedStartTime(ctx))}
+}
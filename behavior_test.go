@@ -0,0 +1,55 @@
+package knock
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Remembers the start time it was given.
+type recording_behavior struct {
+	dummy_behavior
+	t0 time.Time
+}
+
+func (this *recording_behavior) Work(t0 time.Time) (res WorkResult) {
+	this.t0 = t0
+	return WRK_OK
+}
+
+func TestAdaptPassesIntendedStartTime(t *testing.T) {
+	rb := &recording_behavior{}
+	b := Adapt(func() Behavior { return rb })()
+
+	if !expectOk(t, b.Init(context.Background(), nil)) {
+		return
+	}
+
+	t0 := time.Now().Add(-1 * time.Second)
+
+	if b.Work(withIntendedStartTime(context.Background(), t0)).Status != WRK_OK {
+		t.Error("expected the adapted behavior to succeed")
+		return
+	}
+
+	if !rb.t0.Equal(t0) {
+		t.Errorf("expected: %s, got: %s", t0, rb.t0)
+		return
+	}
+
+	b.Close(context.Background())
+}
+
+// Blocks every operation until it's cancelled.
+type blocking_behavior struct{}
+
+func (*blocking_behavior) Init(ctx context.Context, props map[string]string) (err error) {
+	return
+}
+
+func (*blocking_behavior) Close(ctx context.Context) {}
+
+func (*blocking_behavior) Work(ctx context.Context) (res OpResult) {
+	<-ctx.Done()
+	return OpResult{Status: WRK_ERROR}
+}
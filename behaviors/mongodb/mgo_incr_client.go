@@ -1,9 +1,9 @@
-package main
+package mongodb
 
 import (
+	"github.com/dzrw/knock"
 	"labix.org/v2/mgo"
 	"labix.org/v2/mgo/bson"
-	"log"
 )
 
 type mongodb_counters struct {
@@ -16,7 +16,13 @@ func (this *mongodb_counters) Init(info *MongoBehaviorInfo) (err error) {
 	this.conf = info
 	this.collection = info.collection
 
-	err = this.plant_deadbeef_document()
+	// The fixture has usually planted the document already.
+	if info.fixture != nil {
+		this.deadbeef_id = info.fixture
+		return
+	}
+
+	this.deadbeef_id, err = plant_deadbeef_document(this.collection())
 	if err != nil {
 		return
 	}
@@ -28,7 +34,9 @@ func (this *mongodb_counters) Close() {
 	// nothing to do
 }
 
-func (this *mongodb_counters) Work() (res WorkResult) {
+func (this *mongodb_counters) Work() (res knock.OpResult) {
+	res.Label = "upsert"
+
 	doc := M{"$inc": M{"total": 1}, "$set": M{"account_id": "test_1"}}
 	doc["$inc"].(M)[this.randomFieldName()] = 1
 
@@ -36,21 +44,22 @@ func (this *mongodb_counters) Work() (res WorkResult) {
 
 	switch {
 	case err != nil:
-		log.Fatalf("counters: %+v", err)
+		res.Status = knock.WRK_ERROR
 	case info != nil:
-		res = WRK_OK
+		res.Status = knock.WRK_OK
 	case this.conf.writeConcern == -1:
-		res = WRK_OK
+		res.Status = knock.WRK_OK
 	default:
-		res = WRK_WTF
+		res.Status = knock.WRK_WTF
 	}
 
 	return
 }
 
-func (this *mongodb_counters) plant_deadbeef_document() (err error) {
+// Makes sure the document which every client increments exists, and
+// returns its id.
+func plant_deadbeef_document(coll *mgo.Collection) (id interface{}, err error) {
 	doc := M{"$set": M{"stream_id": "deadbeef", "account_id": "test_1"}}
-	coll := this.collection()
 
 	_, err = coll.Upsert(M{"stream_id": "deadbeef"}, doc)
 	if err != nil {
@@ -66,8 +75,7 @@ func (this *mongodb_counters) plant_deadbeef_document() (err error) {
 		return
 	}
 
-	this.deadbeef_id = res.Id
-	return
+	return res.Id, nil
 }
 
 func (this *mongodb_counters) randomFieldName() (name string) {
@@ -1,6 +1,7 @@
-package main
+package mongodb
 
 import (
+	"github.com/dzrw/knock"
 	"labix.org/v2/mgo/bson"
 	_ "log"
 	_ "strconv"
@@ -75,10 +76,10 @@ func TestClientWork(t *testing.T) {
 	orig_total := int(res.Total)
 
 	// Do several units of work
-	var wr WorkResult
+	var wr knock.WorkResult
 	for i := 0; i < 20; i += 1 {
 		wr = client.Work(time.Now())
-		if wr != WRK_OK {
+		if wr != knock.WRK_OK {
 			t.Errorf("expected: WRK_OK, got: %v", wr)
 			return
 		}
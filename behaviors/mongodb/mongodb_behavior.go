@@ -0,0 +1,316 @@
+// Package mongodb registers the MongoDB experiments as the "mongodb"
+// behavior.
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dzrw/knock"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	_ "log"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+const (
+	DEFAULT_MONGO_DATABASE      string = "knock"
+	DEFAULT_MONGO_COLLECTION    string = "userdata"
+	DEFAULT_MONGO_WRITE_CONCERN int    = 1
+
+	// Runs a weighted mix of the experiments.
+	MONGO_MIX = "mix"
+)
+
+// The experiments which can be mixed.
+var MONGO_MIX_EXPERIMENTS = []string{"counters", "reads", "writes"}
+
+// Registers the MongoDB experiments as the "mongodb" behavior.
+func init() {
+	props := []*knock.PropertyInfo{
+		{Name: "mongodb.run", Description: "the experiment to run (counters, reads, writes, or mix)"},
+		{Name: "mongodb.url", Description: "the URL of the server"},
+		{Name: "mongodb.database", Description: "the database to use", Default: DEFAULT_MONGO_DATABASE},
+		{Name: "mongodb.writeConcern", Description: "the write concern (none, w=0 or w=1)", Default: "w=1"},
+		{Name: "fieldcount", Description: "the number of counters to choose from (counters)", Default: "10"},
+		{Name: "mongodb.doc_length", Description: "the length of each document in bytes, at least 64 (writes)", Default: strconv.Itoa(MONGO_DEFAULT_DOCUMENT_LENGTH)},
+		{Name: "mongodb.drop", Description: "whether to drop the collection once the run is over", Default: "false"},
+	}
+
+	for _, run := range MONGO_MIX_EXPERIMENTS {
+		props = append(props, &knock.PropertyInfo{
+			Name:        knock.MIX_WEIGHT_PREFIX + run,
+			Description: fmt.Sprintf("the weight of the %s experiment (mix)", run),
+		})
+	}
+
+	knock.Register(&knock.BehaviorInfo{
+		Name:        "mongodb",
+		Description: "runs one of the MongoDB experiments (counters, reads or writes), or a weighted mix of them, against a server",
+		Properties:  props,
+		ContextFactory: func() knock.ContextBehavior {
+			return &mongodb_runner{}
+		},
+		Fixture: &mongodb_fixture{},
+	})
+}
+
+// Runs the experiment which mongodb.run names, or picks each operation
+// from a weighted mix of them (e.g. 95% reads and 5% counters).
+type mongodb_runner struct {
+	knock.ContextBehavior
+
+	// The experiments in a mix share one session, so that a mix
+	// opens as many connections as a single experiment.
+	shared *mongodb_session
+}
+
+// A session shared by several experiments, which the first of them
+// to start dials.
+type mongodb_session struct {
+	s *mgo.Session
+}
+
+func (this *mongodb_runner) Init(ctx context.Context, props map[string]string) (err error) {
+	if props["mongodb.run"] == MONGO_MIX {
+		this.shared = &mongodb_session{}
+
+		mix := map[string]knock.ContextBehaviorFactory{}
+		for _, run := range MONGO_MIX_EXPERIMENTS {
+			mix[run] = experiment(run, this.shared)
+		}
+
+		this.ContextBehavior = knock.Mix(mix)()
+	} else {
+		this.ContextBehavior = experiment("", nil)()
+	}
+
+	err = this.ContextBehavior.Init(ctx, props)
+	if err != nil {
+		this.closeShared()
+	}
+
+	return
+}
+
+func (this *mongodb_runner) Close(ctx context.Context) {
+	this.ContextBehavior.Close(ctx)
+	this.closeShared()
+}
+
+func (this *mongodb_runner) closeShared() {
+	if this.shared != nil && this.shared.s != nil {
+		this.shared.s.Close()
+		this.shared.s = nil
+	}
+}
+
+// Runs one experiment, or the one mongodb.run names, on a session of
+// its own unless it's given one to share.
+func experiment(run string, shared *mongodb_session) knock.ContextBehaviorFactory {
+	return knock.Adapt(func() knock.Behavior {
+		return &mongodb_behavior{run: run, shared: shared}
+	})
+}
+
+type MongoBehaviorInfo struct {
+	session      *mgo.Session
+	writeConcern int
+	fieldcount   int
+	properties   map[string]string
+	collection   func() *mgo.Collection
+
+	// The value set up by the fixture, or nil if there isn't one.
+	fixture interface{}
+}
+
+type MongoBehavior interface {
+	Init(info *MongoBehaviorInfo) (err error)
+	Close()
+	Work() (res knock.OpResult)
+}
+
+type mongodb_behavior struct {
+	run            string
+	shared         *mongodb_session
+	s              *mgo.Session
+	properties     map[string]string
+	url            string
+	db             string
+	collectionName string
+	writeConcern   int
+	fieldcount     int
+	drop           bool
+	mb             MongoBehavior
+	env            *knock.Env
+}
+
+type M bson.M
+
+func (this *mongodb_behavior) InitEnv(env *knock.Env, props map[string]string) (err error) {
+	this.env = env
+	return this.Init(props)
+}
+
+func (this *mongodb_behavior) Init(props map[string]string) (err error) {
+	err = this.parseProperties(props)
+	if err != nil {
+		return
+	}
+
+	// A shared session belongs to whoever shared it.
+	if this.shared != nil && this.shared.s != nil {
+		this.s = this.shared.s
+	} else {
+		err = this.dial()
+		if err != nil {
+			return
+		}
+
+		if this.shared != nil {
+			this.shared.s = this.s
+		}
+	}
+
+	info := &MongoBehaviorInfo{
+		session:      this.s,
+		writeConcern: this.writeConcern,
+		fieldcount:   this.fieldcount,
+		properties:   this.properties,
+		collection:   this.collection,
+	}
+
+	if this.env != nil {
+		info.fixture = this.env.Fixture
+	}
+
+	err = this.mb.Init(info)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (this *mongodb_behavior) Close() {
+	if this.shared == nil {
+		defer this.s.Close()
+	}
+
+	this.mb.Close()
+}
+
+func (this *mongodb_behavior) Work(t0 time.Time) (res knock.WorkResult) {
+	return this.WorkSized(t0).Status
+}
+
+func (this *mongodb_behavior) WorkSized(t0 time.Time) (res knock.OpResult) {
+	return this.mb.Work()
+}
+
+func (this *mongodb_behavior) collection() *mgo.Collection {
+	return this.s.DB(this.db).C(this.collectionName)
+}
+
+func (this *mongodb_behavior) parseProperties(props map[string]string) (err error) {
+	this.properties = props
+
+	// The experiment is either fixed (in a mix), or a property.
+	run, ok := this.run, this.run != ""
+	if !ok {
+		run, ok = props["mongodb.run"]
+	}
+
+	if ok {
+		switch run {
+		case "counters":
+			this.mb = &mongodb_counters{}
+		case "reads":
+			this.mb = &mongodb_reads{}
+		case "writes":
+			this.mb = &mongodb_writes{}
+		default:
+			return errors.New("mongodb.run must be one of counters, reads, writes")
+		}
+	} else {
+		return errors.New("mongodb.run is a required property")
+	}
+
+	if v, ok := props["mongodb.url"]; ok {
+		this.url = v
+	} else {
+		return errors.New("mongodb.url is a required property")
+	}
+
+	if v, ok := props["mongodb.database"]; ok {
+		this.db = v
+	} else {
+		this.db = DEFAULT_MONGO_DATABASE
+	}
+
+	if v, ok := props["mongodb.writeConcern"]; ok {
+		switch v {
+		case "none":
+			this.writeConcern = -1
+		case "w=0":
+			this.writeConcern = 0
+		case "w=1":
+			this.writeConcern = 1
+		default:
+			return errors.New("mongodb.writeConcern must be one of none, w=0, w=1")
+		}
+	} else {
+		this.writeConcern = DEFAULT_MONGO_WRITE_CONCERN
+	}
+
+	if v, ok := props["fieldcount"]; ok {
+		u, err := strconv.Atoi(v)
+		if err != nil || u <= 0 {
+			return errors.New("fieldcount must be > 0")
+		}
+
+		this.fieldcount = u
+	} else {
+		this.fieldcount = 10
+	}
+
+	if v, ok := props["mongodb.drop"]; ok {
+		u, err := strconv.ParseBool(v)
+		if err != nil {
+			return errors.New("mongodb.drop must be true or false")
+		}
+
+		this.drop = u
+	} else {
+		this.drop = false
+	}
+
+	this.collectionName = DEFAULT_MONGO_COLLECTION
+	return
+}
+
+func (this *mongodb_behavior) dial() (err error) {
+	session, err := mgo.Dial(this.url)
+	if err != nil {
+		return
+	}
+
+	this.s = session
+
+	var safe *mgo.Safe
+	switch {
+	case this.writeConcern == -1:
+		safe = nil
+	case this.writeConcern >= 0:
+		safe = &mgo.Safe{W: this.writeConcern}
+	}
+
+	this.s.SetSafe(safe)
+	return
+}
+
+func randomFieldName(fieldcount int) (name string) {
+	return fmt.Sprintf("field-%d", rand.Intn(fieldcount))
+}
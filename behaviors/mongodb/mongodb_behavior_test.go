@@ -1,6 +1,7 @@
-package main
+package mongodb
 
 import (
+	"context"
 	_ "labix.org/v2/mgo/bson"
 	_ "log"
 	_ "strconv"
@@ -39,6 +40,20 @@ func TestMongoDbBehaviorProperties(t *testing.T) {
 		return
 	}
 
+	props["mongodb.run"] = "reads"
+
+	err = client.parseProperties(props)
+	if !expectOk(t, err) {
+		return
+	}
+
+	if _, ok := client.mb.(*mongodb_reads); !ok {
+		t.Errorf("expected the reads experiment, got: %T", client.mb)
+		return
+	}
+
+	props["mongodb.run"] = "counters"
+
 	if !expectString(t, DEFAULT_MONGO_COLLECTION, client.collectionName) {
 		return
 	}
@@ -123,6 +138,29 @@ func TestMongoDbBehaviorProperties(t *testing.T) {
 	if !expectInt(t, 42, client.fieldcount) {
 		return
 	}
+
+	if !expectBool(t, false, client.drop) {
+		return
+	}
+
+	props["mongodb.drop"] = "maybe"
+
+	err = client.parseProperties(props)
+	if err == nil {
+		t.Error("expected an error when mongodb.drop is not a boolean")
+		return
+	}
+
+	props["mongodb.drop"] = "true"
+
+	err = client.parseProperties(props)
+	if !expectOk(t, err) {
+		return
+	}
+
+	if !expectBool(t, true, client.drop) {
+		return
+	}
 }
 
 func TestMongoDbDialInternals(t *testing.T) {
@@ -230,3 +268,43 @@ func TestMongoDbWriteConcernUnacknowledged(t *testing.T) {
 		return
 	}
 }
+
+func TestMongoDbMixSharesSession(t *testing.T) {
+	r := &mongodb_runner{}
+	props := map[string]string{
+		"mongodb.run":  MONGO_MIX,
+		"mongodb.url":  "mongodb://localhost:27017",
+		"mix.writes":   "1",
+		"mix.counters": "1",
+	}
+
+	err := r.Init(context.Background(), props)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	defer r.Close(context.Background())
+
+	b := &mongodb_behavior{run: "writes", shared: r.shared}
+
+	err = b.Init(props)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if b.s != r.shared.s {
+		t.Error("expected the experiment to use the shared session")
+		return
+	}
+
+	// Closing an experiment leaves the shared session open.
+	b.Close()
+
+	err = r.shared.s.Ping()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+}
@@ -0,0 +1,59 @@
+package mongodb
+
+// Plants the document which the counters and reads experiments use
+// once, before any client starts, rather than having every client
+// race to upsert it, and drops the collection after the run if asked
+// to.
+type mongodb_fixture struct{}
+
+func (this *mongodb_fixture) Setup(props map[string]string) (value interface{}, err error) {
+	b := fixtureBehavior(props)
+
+	err = b.parseProperties(props)
+	if err != nil {
+		return
+	}
+
+	switch b.mb.(type) {
+	case *mongodb_counters, *mongodb_reads:
+	default:
+		return
+	}
+
+	err = b.dial()
+	if err != nil {
+		return
+	}
+
+	defer b.s.Close()
+
+	return plant_deadbeef_document(b.collection())
+}
+
+func (this *mongodb_fixture) Teardown(props map[string]string) (err error) {
+	b := fixtureBehavior(props)
+
+	err = b.parseProperties(props)
+	if err != nil || !b.drop {
+		return
+	}
+
+	err = b.dial()
+	if err != nil {
+		return
+	}
+
+	defer b.s.Close()
+
+	return b.collection().DropCollection()
+}
+
+// A behavior to parse the properties with.  A mix may include the
+// counters and reads experiments, so it gets their document too.
+func fixtureBehavior(props map[string]string) *mongodb_behavior {
+	if props["mongodb.run"] == MONGO_MIX {
+		return &mongodb_behavior{run: "counters"}
+	}
+
+	return &mongodb_behavior{}
+}
@@ -0,0 +1,70 @@
+package mongodb
+
+import (
+	"context"
+	"github.com/dzrw/knock"
+	"testing"
+)
+
+func TestMongoDbFixtureOnlyDialsWhenNeeded(t *testing.T) {
+	fixture := &mongodb_fixture{}
+
+	// Neither of these should need a server.
+	props := map[string]string{
+		"mongodb.run": "writes",
+		"mongodb.url": "mongodb://nowhere.invalid:27017",
+	}
+
+	value, err := fixture.Setup(props)
+	if !expectOk(t, err) {
+		return
+	}
+
+	if value != nil {
+		t.Errorf("expected no value for the writes experiment, got: %v", value)
+		return
+	}
+
+	if !expectOk(t, fixture.Teardown(props)) {
+		return
+	}
+
+	delete(props, "mongodb.run")
+
+	_, err = fixture.Setup(props)
+	if err == nil {
+		t.Error("expected an error when mongodb.run is missing")
+		return
+	}
+}
+
+func TestMongoDbMix(t *testing.T) {
+	info, ok := knock.Lookup("mongodb")
+	if !expectBool(t, true, ok) {
+		return
+	}
+
+	// A mix without any weights fails before it dials.
+	b0 := info.ContextFactory()
+	if b0.Init(context.Background(), map[string]string{"mongodb.run": "mix", "mongodb.url": "x"}) == nil {
+		t.Error("expected an error for a mix without weights")
+		return
+	}
+
+	if !expectString(t, "counters", fixtureBehavior(map[string]string{"mongodb.run": "mix"}).run) {
+		return
+	}
+
+	// Each experiment in the mix ignores mongodb.run.
+	b := &mongodb_behavior{run: "reads"}
+
+	err := b.parseProperties(map[string]string{"mongodb.run": "writes", "mongodb.url": "x"})
+	if !expectOk(t, err) {
+		return
+	}
+
+	if _, ok := b.mb.(*mongodb_reads); !ok {
+		t.Errorf("expected the reads experiment, got: %T", b.mb)
+		return
+	}
+}
@@ -0,0 +1,54 @@
+package mongodb
+
+import (
+	"github.com/dzrw/knock"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+)
+
+// Reads the document which the counters experiment increments, so
+// that the two can be mixed.
+type mongodb_reads struct {
+	conf        *MongoBehaviorInfo
+	deadbeef_id interface{}
+	collection  func() *mgo.Collection
+}
+
+func (this *mongodb_reads) Init(info *MongoBehaviorInfo) (err error) {
+	this.conf = info
+	this.collection = info.collection
+
+	// The fixture has usually planted the document already.
+	if info.fixture != nil {
+		this.deadbeef_id = info.fixture
+		return
+	}
+
+	this.deadbeef_id, err = plant_deadbeef_document(this.collection())
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (this *mongodb_reads) Close() {
+	// nothing to do
+}
+
+func (this *mongodb_reads) Work() (res knock.OpResult) {
+	res.Label = "find"
+
+	var doc bson.Raw
+	err := this.collection().FindId(this.deadbeef_id).One(&doc)
+
+	switch {
+	case err != nil:
+		res.Status = knock.WRK_ERROR
+	default:
+		res.Status = knock.WRK_OK
+		res.ResponseBytes = int64(len(doc.Data))
+	}
+
+	return
+}
@@ -1,10 +1,10 @@
-package main
+package mongodb
 
 import (
 	"errors"
+	"github.com/dzrw/knock"
 	"labix.org/v2/mgo"
 	"labix.org/v2/mgo/bson"
-	"log"
 	"strconv"
 	"strings"
 )
@@ -20,6 +20,9 @@ type mongodb_writes struct {
 	collection  func() *mgo.Collection
 	doc_length  int
 	doc_data    string
+
+	// The size of each document on the wire.
+	doc_bytes int64
 }
 
 func (this *mongodb_writes) Init(info *MongoBehaviorInfo) (err error) {
@@ -32,6 +35,14 @@ func (this *mongodb_writes) Init(info *MongoBehaviorInfo) (err error) {
 	}
 
 	this.doc_data = this.document_data()
+
+	// Every document is the same size, since only its _id changes.
+	raw, err := bson.Marshal(this.document())
+	if err != nil {
+		return
+	}
+
+	this.doc_bytes = int64(len(raw))
 	return
 }
 
@@ -39,13 +50,16 @@ func (this *mongodb_writes) Close() {
 	// nop
 }
 
-func (this *mongodb_writes) Work() (res WorkResult) {
+func (this *mongodb_writes) Work() (res knock.OpResult) {
+	res.Label = "insert"
+	res.RequestBytes = this.doc_bytes
+
 	err := this.insert_document()
 	switch {
 	case err != nil:
-		log.Fatalf("writes: %+v", err)
+		res.Status = knock.WRK_ERROR
 	default:
-		res = WRK_OK
+		res.Status = knock.WRK_OK
 	}
 
 	return
@@ -56,8 +70,7 @@ func (this *mongodb_writes) insert_document() (err error) {
 	// overhead of random data generation from the results.
 	// Hopefully, that doesn't invalidate the test.
 
-	doc := M{"_id": bson.NewObjectId(), "data": this.doc_data}
-	err = this.collection().Insert(doc)
+	err = this.collection().Insert(this.document())
 	if err != nil {
 		return
 	}
@@ -65,6 +78,10 @@ func (this *mongodb_writes) insert_document() (err error) {
 	return
 }
 
+func (this *mongodb_writes) document() M {
+	return M{"_id": bson.NewObjectId(), "data": this.doc_data}
+}
+
 func (this *mongodb_writes) document_data() string {
 	if this.doc_length == MONGO_MIN_DOCUMENT_LENGTH {
 		return "I wrote some Go!" // should be exactly 64 bytes total now.
@@ -1,6 +1,7 @@
-package main
+package mongodb
 
 import (
+	"github.com/dzrw/knock"
 	_ "labix.org/v2/mgo/bson"
 	_ "log"
 	"strconv"
@@ -149,7 +150,7 @@ func TestMongoDbWritesWork(t *testing.T) {
 	// Do several units of work
 	for i := 0; i < 20; i += 1 {
 		wr := b.Work(time.Now())
-		if wr != WRK_OK {
+		if wr != knock.WRK_OK {
 			t.Errorf("expected: WRK_OK, got: %v", wr)
 			return
 		}
@@ -0,0 +1,51 @@
+package knock
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// An operation budget shared by every sandbox in a run.  Budgets
+// are spent when an operation completes successfully, rather than
+// when it starts, so that a run which stops on its budget has
+// performed exactly that many successful operations; anything
+// still in flight when the budget runs out is discarded.
+type opBudget struct {
+	limit int64
+	spent int64
+	once  sync.Once
+	done  chan struct{}
+}
+
+func NewBudget(limit int64) *opBudget {
+	return &opBudget{
+		limit: limit,
+		done:  make(chan struct{}),
+	}
+}
+
+// Spends one operation from the budget.  Returns false if the
+// budget had already been used up.
+func (this *opBudget) spend() (ok bool) {
+	n := atomic.AddInt64(&this.spent, 1)
+
+	if n >= this.limit {
+		this.once.Do(func() { close(this.done) })
+	}
+
+	return n <= this.limit
+}
+
+// Closed once the budget has been used up.
+func (this *opBudget) Done() <-chan struct{} {
+	return this.done
+}
+
+func (this *opBudget) exhausted() (ok bool) {
+	select {
+	case <-this.done:
+		return true
+	default:
+		return false
+	}
+}
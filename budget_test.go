@@ -0,0 +1,42 @@
+package knock
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBudget(t *testing.T) {
+	const (
+		Limit   = 1000
+		Clients = 8
+	)
+
+	budget := NewBudget(Limit)
+	wg := &sync.WaitGroup{}
+	spent := int64(0)
+
+	for i := 0; i < Clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for !budget.exhausted() {
+				if budget.spend() {
+					atomic.AddInt64(&spent, 1)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if !expectInt(t, Limit, int(spent)) {
+		return
+	}
+
+	if budget.spend() {
+		t.Error("expected an exhausted budget to refuse to spend")
+		return
+	}
+}
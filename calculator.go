@@ -1,29 +1,53 @@
-package main
+package knock
 
 import (
-	"github.com/ryszard/goskiplist/skiplist"
+	"fmt"
 	_ "log"
 	"math"
+	"sort"
 	"time"
 )
 
+const (
+	// The error rate isn't judged until at least this many
+	// operations have been attempted.
+	MIN_ERROR_RATE_SAMPLES = 100
+)
+
 type Statistics interface {
 	StartTime() time.Time
+	RunTime() time.Duration
+	MeasuredTime() time.Duration
+	Interrupted() bool
+	StopReason() string
 
+	Operations() int64
 	Throughput() float64
-	MeanResponseTimeUsec() float64
+	RequestBytes() int64
+	ResponseBytes() int64
+	Bandwidth() (req, resp float64)
+	MeanResponseTime() time.Duration
+	MeanThinkTime() time.Duration
 	Efficiency() float64
 	Histogram2() (res *HistogramResult)
+	Corrected() (res *HistogramResult, interval time.Duration, ok bool)
+	Labels() (res []*LabelResult)
+	Groups() (res []*GroupResult)
+	Metrics() (res []*MetricResult)
+	Timeline() (res []*IntervalResult)
 	Errors() map[WorkResult]int
+	TimeoutRate() float64
+	FailedResponseTimes() map[WorkResult]*HistogramResult
+	Schedule() (res *ScheduleResult, ok bool)
 
 	IsClientTrackingEnabled() (ok bool)
-	HistogramByClientId(clientId int) (hist map[int64]int, ok bool)
+	HistogramByClientId(clientId int) (hist *Histogram, ok bool)
 }
 
 type bucket struct {
 	id int
 
-	hist map[int64]int
+	hist *Histogram
 
 	curr_lag_sum int64
 	prev_lag_avg float64
@@ -31,90 +55,315 @@ type bucket struct {
 	prev_ops_sum int64
 }
 
-func (this *bucket) observe(usec int64) {
-	if count, ok := this.hist[usec]; ok {
-		this.hist[usec] = count + 1
-	} else {
-		this.hist[usec] = 1
-	}
+func (this *bucket) merge(s *shard) {
+	this.hist.Merge(s.hist)
 
-	this.curr_lag_sum += usec
-	this.curr_ops_sum += 1
+	this.curr_lag_sum += s.lag_sum
+	this.curr_ops_sum += s.ops
 }
 
 type calculator struct {
+	conf        *Config
 	t0          time.Time
-	ch          LatencyEventsChannel
+	t1          time.Time
+	stopReason  string
+	warmup      time.Duration
+	measured    time.Duration
+	recorders   []*recorder
+	spare       *shard
 	emitter     SummaryEmitter
+	sched       *scheduler
 	clients     map[int]*bucket
 	clientStats bool
 	clientCount int
 	errors      map[WorkResult]int
 
+	// The response times of the failed operations, by status.
+	failed map[WorkResult]*Histogram
+
+	// The time clients spent thinking between operations, and its
+	// average per operation.
+	think_sum      int64
+	prev_think_avg float64
+
+	// The bytes sent and received by the behavior.
+	req_bytes  int64
+	resp_bytes int64
+
+	// Everything recorded for each labeled type of operation.
+	labels map[string]*shard
+
+	// The behavior's own metrics.
+	metrics metricTotals
+
+	// The response times and errors since the last summary, and the
+	// statistics of every interval so far.
+	interval        *Histogram
+	interval_errors map[WorkResult]int
+	timeline        []*IntervalResult
+	timeline_t      time.Duration
+
+	// Everything recorded by each group of clients, and the group
+	// of each client.
+	groups  map[string]*shard
+	groupOf []*Group
+
+	// Every failed operation, and the error budget.
+	failures     int64
+	maxErrors    int
+	maxErrorRate float64
+
+	// The number of active clients, and its integral over the
+	// measured time (in client-seconds).
+	active   int
+	load_sum float64
+	load_t   time.Duration
+
 	bucket
 }
 
-func NewCalculator(conf *AppConfig, ch LatencyEventsChannel, emitter SummaryEmitter, t0 time.Time) *calculator {
+func NewCalculator(conf *Config, recorders []*recorder, emitter SummaryEmitter, sched *scheduler, t0 time.Time) *calculator {
 	this := &calculator{
-		t0:          t0,
-		ch:          ch,
-		emitter:     emitter,
-		clients:     nil,
-		clientCount: conf.Clients,
-		clientStats: conf.PerClientStats,
-		errors:      make(map[WorkResult]int),
+		conf:            conf,
+		t0:              t0,
+		warmup:          conf.Warmup,
+		measured:        conf.Duration,
+		recorders:       recorders,
+		spare:           newShard(conf.HistogramPrecision),
+		emitter:         emitter,
+		sched:           sched,
+		clients:         nil,
+		clientCount:     conf.MaxClients(),
+		clientStats:     conf.PerClientStats,
+		errors:          make(map[WorkResult]int),
+		failed:          make(map[WorkResult]*Histogram),
+		labels:          make(map[string]*shard),
+		metrics:         newMetricTotals(),
+		interval:        NewHistogram(conf.HistogramPrecision),
+		interval_errors: make(map[WorkResult]int),
+		active:          conf.MaxClients(),
+		maxErrors:       conf.MaxErrors,
+		maxErrorRate:    conf.MaxErrorRate,
 		bucket: bucket{
 			id:   -1,
-			hist: make(map[int64]int),
+			hist: NewHistogram(conf.HistogramPrecision),
 		},
 	}
 
+	if len(conf.Groups) > 0 {
+		this.groups = make(map[string]*shard)
+
+		for _, g := range conf.Groups {
+			this.groups[g.Name] = newShard(conf.HistogramPrecision)
+		}
+
+		for i := 0; i < this.clientCount; i++ {
+			this.groupOf = append(this.groupOf, conf.groupOf(i))
+		}
+	}
+
 	if this.clientStats {
 		this.clients = make(map[int]*bucket)
 		for i := 0; i < this.clientCount; i++ {
-			this.clients[i] = &bucket{id: i, hist: make(map[int64]int)}
+			this.clients[i] = &bucket{id: i, hist: NewHistogram(conf.HistogramPrecision)}
 		}
 	}
 
 	return this
 }
 
+// The configuration of the run, with the defaults filled in.
+func (this *calculator) Config() *Config {
+	conf := *this.conf
+	return &conf
+}
+
 func (this *calculator) StartTime() time.Time {
 	return this.t0
 }
 
+// Records the end of the run, and why it was cut short (if it was).
+func (this *calculator) finish(reason string) {
+	this.t1 = time.Now()
+	this.stopReason = reason
+}
+
+func (this *calculator) Interrupted() bool {
+	return this.stopReason != ""
+}
+
+func (this *calculator) StopReason() string {
+	return this.stopReason
+}
+
+// The wall-clock time of the run so far, or of the entire run
+// once it has finished.
+func (this *calculator) RunTime() time.Duration {
+	if this.t1.IsZero() {
+		return time.Since(this.t0)
+	}
+
+	return this.t1.Sub(this.t0)
+}
+
+// The portion of the run which has been measured so far, which
+// excludes the warmup and cooldown phases.
+func (this *calculator) MeasuredTime() time.Duration {
+	d := this.RunTime() - this.warmup
+
+	switch {
+	case d < 0:
+		return 0
+	case d > this.measured:
+		return this.measured
+	default:
+		return d
+	}
+}
+
 func (this *calculator) Errors() map[WorkResult]int {
 	return this.errors
 }
 
+// The fraction of all attempted operations which timed out.
+func (this *calculator) TimeoutRate() float64 {
+	total := this.prev_ops_sum
+	for _, count := range this.errors {
+		total += int64(count)
+	}
+
+	if total == 0 {
+		return 0
+	}
+
+	return float64(this.errors[WRK_TIMEOUT]) / float64(total)
+}
+
+// The response times of the operations which failed or timed out, by
+// status; they're kept apart from those of the operations which
+// succeeded.
+func (this *calculator) FailedResponseTimes() map[WorkResult]*HistogramResult {
+	return failedHistograms(this.failed)
+}
+
+func failedHistograms(failed map[WorkResult]*Histogram) (res map[WorkResult]*HistogramResult) {
+	res = make(map[WorkResult]*HistogramResult)
+	for status, h := range failed {
+		if h.Count() > 0 {
+			res[status] = histogram(h, 1)
+		}
+	}
+
+	return
+}
+
+// Reports on the arrival schedule of an open-loop run.
+func (this *calculator) Schedule() (res *ScheduleResult, ok bool) {
+	if this.sched == nil {
+		return
+	}
+
+	return this.sched.Result(), true
+}
+
+// The number of successful operations measured so far.
+func (this *calculator) Operations() int64 {
+	return this.prev_ops_sum
+}
+
+// Checks whether too many operations have failed to carry on.
+func (this *calculator) overErrorBudget() (reason string, ok bool) {
+	if this.maxErrors > 0 && this.failures > int64(this.maxErrors) {
+		return fmt.Sprintf("%d operations failed, more than the %d allowed",
+			this.failures, this.maxErrors), true
+	}
+
+	if this.maxErrorRate > 0 {
+		total := this.failures + this.prev_ops_sum + this.curr_ops_sum
+		rate := float64(this.failures) / float64(total)
+
+		if total >= MIN_ERROR_RATE_SAMPLES && rate > this.maxErrorRate {
+			return fmt.Sprintf("%.4f%% of operations failed, more than the %.4f%% allowed",
+				100*rate, 100*this.maxErrorRate), true
+		}
+	}
+
+	return
+}
+
 func (this *calculator) Throughput() float64 {
-	return float64(this.prev_ops_sum) / time.Since(this.t0).Seconds()
+	d := this.MeasuredTime()
+	if d <= 0 {
+		return 0
+	}
+
+	return float64(this.prev_ops_sum) / d.Seconds()
+}
+
+// The bytes sent by every measured operation.
+func (this *calculator) RequestBytes() int64 {
+	return this.req_bytes
 }
 
-func (this *calculator) MeanResponseTimeUsec() float64 {
-	const EPSILON = float64(1*time.Microsecond) / 10
+// The bytes received by every measured operation.
+func (this *calculator) ResponseBytes() int64 {
+	return this.resp_bytes
+}
 
-	if this.prev_lag_avg < EPSILON {
-		return EPSILON
+// The bytes sent and received per second.
+func (this *calculator) Bandwidth() (req, resp float64) {
+	d := this.MeasuredTime()
+	if d <= 0 {
+		return
 	}
 
-	return this.prev_lag_avg
+	return float64(this.req_bytes) / d.Seconds(), float64(this.resp_bytes) / d.Seconds()
 }
 
+func (this *calculator) MeanResponseTime() time.Duration {
+	return time.Duration(this.prev_lag_avg)
+}
+
+// The average think time between operations.
+func (this *calculator) MeanThinkTime() time.Duration {
+	return time.Duration(this.prev_think_avg)
+}
+
+// Clients which are thinking are doing exactly what they should be,
+// so think time counts towards the active load.
 func (this *calculator) Efficiency() float64 {
 	throughput := this.Throughput()
-	responseTime := this.MeanResponseTimeUsec()
-	active_load := responseTime * (throughput / 1e6)
-	planned_load := float64(this.clientCount)
-	efficiency := active_load / planned_load
-	return efficiency
+	return efficiency(this.plannedLoad(), throughput, this.prev_lag_avg+this.prev_think_avg)
+}
+
+// Records a change in the number of active clients.
+func (this *calculator) setLoad(clients int) {
+	this.integrateLoad()
+	this.active = clients
+}
+
+func (this *calculator) integrateLoad() {
+	d := this.MeasuredTime()
+	this.load_sum += float64(this.active) * (d - this.load_t).Seconds()
+	this.load_t = d
+}
+
+// The average number of active clients over the measured time.
+func (this *calculator) plannedLoad() float64 {
+	this.integrateLoad()
+
+	if this.load_t <= 0 {
+		return float64(this.active)
+	}
+
+	return this.load_sum / this.load_t.Seconds()
 }
 
 func (this *calculator) IsClientTrackingEnabled() bool {
 	return this.clientStats
 }
 
-func (this *calculator) HistogramByClientId(clientId int) (hist map[int64]int, ok bool) {
+func (this *calculator) HistogramByClientId(clientId int) (hist *Histogram, ok bool) {
 	bucket, ok := this.clients[clientId]
 	if !ok {
 		return
@@ -123,80 +372,222 @@ func (this *calculator) HistogramByClientId(clientId int) (hist map[int64]int, o
 	return bucket.hist, true
 }
 
+// The response time distribution of a run, in nanoseconds.
 type HistogramResult struct {
-	dist         *skiplist.SkipList
-	cdf          *skiplist.SkipList
-	p5, p95, p99 int
-	min, max     int64
-	errors       map[WorkResult]int
+	// One row per bucket of response times, fastest first.
+	Rows []*HistogramRow
+
+	P5, P95, P99 int64
+	Min, Max     int64
+
+	// The mean, standard deviation and median of the response times,
+	// and their coefficient of variation (the standard deviation
+	// divided by the mean).
+	Mean, StdDev, CV float64
+	Median           int64
+
+	// The number of response times.
+	Count int64
+
+	hist *Histogram
+}
+
+type HistogramRow struct {
+	// The lowest response time in the bucket.
+	Nsec int64
+	CDF  float64
+
+	// The overall count, followed by one per client if client
+	// tracking is enabled.
+	Counts []int
+}
+
+// Any percentile (0-100) of the distribution, e.g. 50 or 99.99.
+func (this *HistogramResult) Percentile(p float64) int64 {
+	return this.hist.Percentile(p)
 }
 
 func (this *calculator) Histogram2() (res *HistogramResult) {
-	res = &HistogramResult{
-		dist: skiplist.NewIntMap(),
-		cdf:  skiplist.NewIntMap(),
+	columns := 1
+	if this.IsClientTrackingEnabled() {
+		columns = this.clientCount + 1
 	}
 
-	min := int64(1e9)
-	max := int64(0)
+	res = histogram(this.hist, columns)
 
-	// Copy our histogram map into an ordered skiplist.
-	for usec, freq := range this.hist {
-		if usec < min {
-			min = usec
-		}
-
-		if usec > max {
-			max = usec
+	// Extend the rows with per-client stats, if enabled.  Every
+	// histogram has the same buckets, so the rows line up.
+	if this.IsClientTrackingEnabled() {
+		for id, bucket := range this.clients {
+			for _, row := range res.Rows {
+				row.Counts[id+1] = int(bucket.hist.countAt(row.Nsec))
+			}
 		}
+	}
 
-		v := []int{freq}
-		if this.IsClientTrackingEnabled() {
-			v = make([]int, this.clientCount+1)
-			v[0] = freq
-		}
+	return
+}
 
-		res.dist.Set(int(usec), v)
+// Summarizes a distribution, leaving room in each row for the given
+// number of counts.
+func histogram(hist *Histogram, columns int) (res *HistogramResult) {
+	res = &HistogramResult{
+		P5:     hist.Percentile(5),
+		P95:    hist.Percentile(95),
+		P99:    hist.Percentile(99),
+		Min:    hist.Min(),
+		Max:    hist.Max(),
+		Mean:   hist.Mean(),
+		StdDev: hist.StdDev(),
+		Median: hist.Percentile(50),
+		Count:  hist.Count(),
+		hist:   hist.Copy(),
 	}
 
-	res.min = min
-	res.max = max
+	if res.Mean > 0 {
+		res.CV = res.StdDev / res.Mean
+	}
 
 	// Build the CDF.
+	total := hist.Count()
 	sum := int64(0)
 
-	iter := res.dist.Iterator()
-	for iter.Next() {
-		usec := iter.Key().(int)
-		vs := iter.Value().([]int)
-		freq := int64(vs[0])
+	hist.ForEach(func(nsec, count int64) {
+		sum += count
 
-		sum += freq
+		counts := make([]int, columns)
+		counts[0] = int(count)
 
-		v := float64(sum) / float64(this.prev_ops_sum)
+		res.Rows = append(res.Rows, &HistogramRow{nsec, float64(sum) / float64(total), counts})
+	})
 
-		switch {
-		case res.p5 == 0 && v >= 0.05:
-			res.p5 = usec
-		case res.p95 == 0 && v >= 0.95:
-			res.p95 = usec
-		case res.p99 == 0 && v >= 0.99:
-			res.p99 = usec
-		}
+	return
+}
 
-		res.cdf.Set(usec, v)
+// The response time distribution corrected for coordinated omission,
+// and the expected interval between each client's operations which
+// the correction assumed.  Only available if Config.CorrectOmission is
+// set.
+func (this *calculator) Corrected() (res *HistogramResult, interval time.Duration, ok bool) {
+	if !this.conf.CorrectOmission {
+		return
 	}
 
-	// Extend the skiplist with per-client stats, if enabled.
-	if this.IsClientTrackingEnabled() {
-		for id, bucket := range this.clients {
-			for usec, count := range bucket.hist {
-				v, ok := res.dist.Get(int(usec))
-				if ok {
-					v.([]int)[id+1] = count
-				}
-			}
-		}
+	interval = this.expectedInterval()
+	return histogram(this.hist.Corrected(int64(interval)), 1), interval, true
+}
+
+// The median is used rather than the mean, since the stalls which
+// need correcting would drag the mean up.
+func (this *calculator) expectedInterval() time.Duration {
+	switch {
+	case this.conf.ExpectedInterval > 0:
+		return this.conf.ExpectedInterval
+	case this.conf.Pace > 0:
+		return this.conf.Pace
+	default:
+		return time.Duration(this.hist.Percentile(50)) + this.MeanThinkTime()
+	}
+}
+
+// The behavior's own metrics, sorted by name.
+func (this *calculator) Metrics() (res []*MetricResult) {
+	return this.metrics.results(this.MeasuredTime())
+}
+
+// The statistics of one labeled type of operation.
+type LabelResult struct {
+	Label            string
+	Operations       int64
+	Throughput       float64
+	MeanResponseTime time.Duration
+	Errors           map[WorkResult]int
+	RequestBytes     int64
+	ResponseBytes    int64
+	Histogram        *HistogramResult
+}
+
+// The statistics of each labeled type of operation, sorted by label.
+// Operations which time out or panic can't be labeled, and only count
+// towards the combined statistics.
+func (this *calculator) Labels() (res []*LabelResult) {
+	d := this.MeasuredTime()
+
+	for name, s := range this.labels {
+		throughput, mean := rates(s, d)
+		hist := histogram(s.hist, 1)
+
+		res = append(res, &LabelResult{
+			Label:            name,
+			Operations:       s.ops,
+			Throughput:       throughput,
+			MeanResponseTime: mean,
+			Errors:           s.errors,
+			RequestBytes:     s.req_bytes,
+			ResponseBytes:    s.resp_bytes,
+			Histogram:        hist,
+		})
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Label < res[j].Label
+	})
+
+	return
+}
+
+// The statistics of one group of clients.
+type GroupResult struct {
+	Name             string
+	Clients          int
+	Operations       int64
+	Throughput       float64
+	MeanResponseTime time.Duration
+	Errors           map[WorkResult]int
+	RequestBytes     int64
+	ResponseBytes    int64
+	Histogram        *HistogramResult
+
+	// The response times of the failed operations, by status.
+	Failed map[WorkResult]*HistogramResult
+}
+
+// The statistics of each group of clients, in the order they were
+// given, or nil if the run doesn't have any.
+func (this *calculator) Groups() (res []*GroupResult) {
+	d := this.MeasuredTime()
+
+	for _, g := range this.conf.Groups {
+		s := this.groups[g.Name]
+		throughput, mean := rates(s, d)
+		hist := histogram(s.hist, 1)
+
+		res = append(res, &GroupResult{
+			Name:             g.Name,
+			Clients:          g.Clients,
+			Operations:       s.ops,
+			Throughput:       throughput,
+			MeanResponseTime: mean,
+			Errors:           s.errors,
+			RequestBytes:     s.req_bytes,
+			ResponseBytes:    s.resp_bytes,
+			Histogram:        hist,
+			Failed:           failedHistograms(s.failed),
+		})
+	}
+
+	return
+}
+
+// The throughput and mean response time of a subset of the
+// operations.
+func rates(s *shard, d time.Duration) (throughput float64, mean time.Duration) {
+	if d > 0 {
+		throughput = float64(s.ops) / d.Seconds()
+	}
+
+	if s.ops > 0 {
+		mean = time.Duration(s.lag_sum / s.ops)
 	}
 
 	return
@@ -209,58 +600,58 @@ func (this *calculator) Histogram2() (res *HistogramResult) {
 // 	return newslice
 // }
 
-func (this *calculator) capture(count int) {
-	ch := this.ch
-	hist := this.hist
-	chunk_lag := int64(0)
-	chunk_ops := int64(0)
+// Merges what every client has recorded since the last time.
+func (this *calculator) collect() {
+	for _, rec := range this.recorders {
+		s := rec.swap(this.spare)
 
-	clients := this.clients
-	clientStats := this.clientStats
+		this.bucket.merge(s)
+		this.interval.Merge(s.hist)
 
-	for i := 0; i < count; i += 1 {
-		evt, ok := <-ch
-		if !ok {
-			break
+		if this.clientStats {
+			this.clients[rec.id].merge(s)
 		}
 
-		// Count errors, but don't pollute the ops counter.
-		if evt.result != WRK_OK {
-			if v, ok := this.errors[evt.result]; ok {
-				this.errors[evt.result] = v + 1
-			} else {
-				this.errors[evt.result] = 1
-			}
+		this.think_sum += s.think_sum
+		this.req_bytes += s.req_bytes
+		this.resp_bytes += s.resp_bytes
+
+		this.metrics.merge(rec.id, s)
 
-			continue
+		if this.groupOf != nil {
+			this.groups[this.groupOf[rec.id].Name].merge(s)
 		}
 
-		usec := evt.usec
+		for name, ls := range s.labels {
+			if this.labels[name] == nil {
+				this.labels[name] = newShard(this.conf.HistogramPrecision)
+			}
 
-		// Update the per-client stats, if necessary.
-		if clientStats {
-			clients[evt.id].observe(evt.usec)
+			this.labels[name].merge(ls)
 		}
 
-		// Update the histogram
-		if count, ok := hist[usec]; ok {
-			hist[usec] = count + 1
-		} else {
-			hist[usec] = 1
+		for res, count := range s.errors {
+			this.errors[res] += count
+			this.interval_errors[res] += count
+			this.failures += int64(count)
 		}
 
-		chunk_lag += usec
-		chunk_ops += 1
-	}
+		for res, h := range s.failed {
+			if this.failed[res] == nil {
+				this.failed[res] = NewHistogram(this.conf.HistogramPrecision)
+			}
+
+			this.failed[res].Merge(h)
+		}
 
-	// Update the intermediate sums
-	this.curr_lag_sum += chunk_lag
-	this.curr_ops_sum += chunk_ops
+		s.reset()
+		this.spare = s
+	}
 }
 
 func (this *calculator) summarize() {
-	// Run Time
-	d := time.Since(this.t0)
+	// Measured Time
+	d := this.MeasuredTime()
 
 	// Total Ops
 	next_ops_sum := this.prev_ops_sum + this.curr_ops_sum
@@ -282,25 +673,110 @@ func (this *calculator) summarize() {
 	}
 
 	// Compute the current throughput ops/sec
-	next_ops_per_sec := float64(next_ops_sum) / d.Seconds()
+	next_ops_per_sec := float64(0)
+	if d > 0 {
+		next_ops_per_sec = float64(next_ops_sum) / d.Seconds()
+	}
+
+	// Compute the average think time
+	next_think_avg := this.prev_think_avg
+	if next_ops_sum > 0 {
+		next_think_avg = float64(this.think_sum) / float64(next_ops_sum)
+	}
 
 	// Compute the active load and load efficiency
-	eff := efficiency(this.clientCount, next_ops_per_sec, next_lag_avg)
+	eff := efficiency(this.plannedLoad(), next_ops_per_sec, next_lag_avg+next_think_avg)
+
+	this.keepInterval(d)
 
 	// Update
 	this.prev_lag_avg = next_lag_avg
 	this.prev_ops_sum = next_ops_sum
+	this.prev_think_avg = next_think_avg
 
 	// Reset counters
 	this.curr_lag_sum = 0
 	this.curr_ops_sum = 0
 
-	this.emitter.PublishSummaryEvent(d, next_ops_per_sec, next_lag_avg, eff)
+	req_bw, resp_bw := this.Bandwidth()
+
+	this.metrics.sample()
+
+	// The chosen percentile of the response times since the last
+	// summary, rather than of the whole run.
+	percentile := this.conf.SummaryPercentile
+	interval_lag := time.Duration(this.interval.Percentile(percentile))
+	this.interval.Reset()
+
+	this.emitter.PublishSummaryEvent(d, next_ops_per_sec, time.Duration(next_lag_avg), eff, this.active, req_bw, resp_bw, this.metrics.snapshot(), percentile, interval_lag)
+}
+
+// The statistics of one progress interval on its own, rather than
+// added to those before it.
+type IntervalResult struct {
+	// The measured time at the end of the interval, and how much of
+	// the interval was measured.
+	Elapsed  time.Duration
+	Duration time.Duration
+
+	Operations       int64
+	Throughput       float64
+	MeanResponseTime time.Duration
+	P50, P99, Max    time.Duration
+	Errors           map[WorkResult]int
+	Clients          int
+}
+
+// The statistics of each progress interval, in order.  Throughput
+// dips and latency spikes which the totals average away show up here.
+func (this *calculator) Timeline() (res []*IntervalResult) {
+	return this.timeline
+}
+
+// Keeps the statistics of the interval since the last summary.
+// Intervals which fall entirely within the warmup or cooldown phases
+// aren't kept, since nothing in them was measured.  Operations which
+// complete just as the measured time runs out can still land in an
+// interval without any measured time, though; it's kept, with a
+// throughput of 0.
+func (this *calculator) keepInterval(d time.Duration) {
+	errors := this.interval_errors
+	this.interval_errors = make(map[WorkResult]int)
+
+	dt := d - this.timeline_t
+	if dt <= 0 && this.curr_ops_sum == 0 && len(errors) == 0 {
+		return
+	}
+
+	throughput := float64(0)
+	if dt > 0 {
+		throughput = float64(this.curr_ops_sum) / dt.Seconds()
+	}
+
+	res := &IntervalResult{
+		Elapsed:    d,
+		Duration:   dt,
+		Operations: this.curr_ops_sum,
+		Throughput: throughput,
+		P50:        time.Duration(this.interval.Percentile(50)),
+		P99:        time.Duration(this.interval.Percentile(99)),
+		Max:        time.Duration(this.interval.Max()),
+		Errors:     errors,
+		Clients:    this.active,
+	}
+
+	if this.curr_ops_sum > 0 {
+		res.MeanResponseTime = time.Duration(this.curr_lag_sum / this.curr_ops_sum)
+	}
+
+	this.timeline = append(this.timeline, res)
+	this.timeline_t = d
 }
 
-func efficiency(load int, throughput, responseTimeUs float64) float64 {
-	active_load := responseTimeUs * (throughput / 1e6)
-	planned_load := float64(load)
+// The response time is in nanoseconds.
+func efficiency(load, throughput, responseTime float64) float64 {
+	active_load := responseTime * (throughput / 1e9)
+	planned_load := load
 	efficiency := active_load / planned_load
 	return efficiency
 }
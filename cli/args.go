@@ -0,0 +1,247 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dzrw/knock"
+	goflags "github.com/jessevdk/go-flags"
+	"math"
+	"time"
+)
+
+const (
+	MIN_RUN_TIME = 5
+
+	// Derives the expected interval from the run (see
+	// knock.Config.ExpectedInterval).
+	EXPECTED_INTERVAL_AUTO = "auto"
+)
+
+type AppConfig struct {
+	Behavior       string            `short:"b" long:"behavior" value-name:"NAME" description:"the registered behavior to run (see: knock behaviors)" default:"" optional:"true"`
+	Clients        int               `short:"c" long:"clients" value-name:"CLIENTS" description:"the number of individual load elements" default:"0" optional:"true"`
+	Duration       int               `short:"d" long:"duration" value-name:"SECONDS" description:"the number of seconds to run this benchmark" default:"0" optional:"true"`
+	Ops            int               `short:"n" long:"ops" value-name:"TOTAL_OPS" description:"stop after this many successful operations" default:"0" optional:"true"`
+	ClientOps      int               `long:"client-ops" value-name:"OPS" description:"stop each client after this many successful operations" default:"0" optional:"true"`
+	OpTimeout      time.Duration     `long:"op-timeout" value-name:"DURATION" description:"give up on an operation which takes longer than this (e.g. 500ms)" default:"0" optional:"true"`
+	OnTimeout      string            `long:"on-timeout" value-name:"POLICY" description:"what a client does after a timeout (reinit or abandon)" default:"reinit" optional:"true"`
+	ReinitAfter    int               `long:"reinit-after" value-name:"FAILURES" description:"re-initialize a client's behavior after this many consecutive errors" default:"0" optional:"true"`
+	MaxErrors      int               `long:"max-errors" value-name:"COUNT" description:"abort the run once more than this many operations have failed" default:"0" optional:"true"`
+	MaxErrorRate   float64           `long:"max-error-rate" value-name:"FRACTION" description:"abort the run once more than this fraction of operations have failed (e.g. 0.01)" default:"0" optional:"true"`
+	Warmup         int               `long:"warmup" value-name:"SECONDS" description:"the number of seconds to run before measuring" default:"0" optional:"true"`
+	Cooldown       int               `long:"cooldown" value-name:"SECONDS" description:"the number of seconds to keep running after measuring" default:"0" optional:"true"`
+	Verbose        bool              `short:"v" long:"verbose" default:"false" optional:"true"`
+	PerClientStats bool              `long:"client-stats" default:"false" optional:"true" description:"whether or not to track individual client statistics"`
+	Properties     map[string]string `short:"p" description:"additional properties" optional:"true"`
+	Version        bool              `long:"version" optional:"true" default:"false" description:"display version information"`
+	Profiles       map[string]string `short:"r" long:"runtime-profile" optional:"true" description:"Go runtime profiles (e.g. cpu, memory, block, threadcount, or behavior-specifc)"`
+	Rate           float64           `long:"rate" value-name:"OPS" description:"issue operations open-loop at this many ops/sec instead of back-to-back" default:"0" optional:"true"`
+	Arrival        string            `long:"arrival" value-name:"SCHEDULE" description:"the open-loop arrival schedule (fixed or poisson)" default:"fixed" optional:"true"`
+	Think          string            `long:"think" value-name:"DIST" description:"pause between operations (e.g. 5ms, uniform:5ms,15ms, exp:10ms, or normal:10ms,2ms)" default:"" optional:"true"`
+	Pace           time.Duration     `long:"pace" value-name:"DURATION" description:"start each client's operations this far apart" default:"0" optional:"true"`
+	Profile        string            `long:"profile" value-name:"STAGES" description:"vary the number of clients over time (e.g. \"ramp:1->64 over 60s, hold 120s, spike 256 for 10s\")" default:"" optional:"true"`
+	Sweep          string            `long:"sweep" value-name:"PARAM=LEVELS" description:"run one round per load level, and report them side by side (e.g. clients=1,2,4,8)" default:"" optional:"true"`
+	Groups         []string          `long:"group" value-name:"NAME:SPEC" description:"run a group of clients with its own properties, or behavior, alongside the others (e.g. writers:c=8,mongodb.run=writes)" optional:"true"`
+	Seed           int64             `long:"seed" value-name:"N" description:"seed each client's random numbers, to repeat a run (0 picks one)" default:"0" optional:"true"`
+	Precision      int               `long:"precision" value-name:"DIGITS" description:"the significant digits kept by the latency histograms (1-5)" default:"3" optional:"true"`
+	Percentiles    string            `long:"percentiles" value-name:"LIST" description:"the response time percentiles to report" default:"5,95,99,99.9,99.99" optional:"true"`
+	Interval       string            `long:"expected-interval" value-name:"DURATION" description:"correct the response times for coordinated omission, assuming each client means to start an operation this often (or auto)" default:"" optional:"true"`
+	Timeline       string            `long:"timeline" value-name:"FILE" description:"write the statistics of each progress interval to a CSV file" default:"" optional:"true"`
+	Rolling        float64           `long:"summary-percentile" value-name:"P" description:"the percentile of each interval's response times to show in the progress summaries" default:"99" optional:"true"`
+
+	sweep       *loadSweep
+	groups      []*groupSpec
+	percentiles []float64
+
+	// The validated configuration handed to knock.Run.
+	conf knock.Config
+}
+
+// Whether operations are issued on a schedule rather than
+// back-to-back by each client.
+func (this *AppConfig) IsOpenLoop() bool {
+	return this.conf.IsOpenLoop()
+}
+
+// Parses the command-line arguments, and validates them.
+func parseArgs(args []string) (opts *AppConfig, err error) {
+	opts = &AppConfig{}
+
+	_, err = goflags.ParseArgs(opts, args)
+	if err != nil {
+		return
+	}
+
+	// fix bad values...
+	if opts.Clients < knock.MIN_LOAD {
+		opts.Clients = knock.MIN_LOAD
+	}
+
+	if opts.Ops < 0 {
+		opts.Ops = 0
+	}
+
+	if opts.ClientOps < 0 {
+		opts.ClientOps = 0
+	}
+
+	switch {
+	case opts.Profile != "":
+		// A load profile decides the length of the run.
+
+	case opts.Duration == 0 && opts.IsCounted():
+		// Run until the operation budget has been spent.
+
+	case opts.Duration < MIN_RUN_TIME:
+		opts.Duration = MIN_RUN_TIME
+	}
+
+	if opts.Warmup < 0 {
+		opts.Warmup = 0
+	}
+
+	if opts.Cooldown < 0 {
+		opts.Cooldown = 0
+	}
+
+	if opts.Rate < 0 {
+		opts.Rate = 0
+	}
+
+	if opts.OpTimeout < 0 {
+		opts.OpTimeout = 0
+	}
+
+	if opts.ReinitAfter < 0 {
+		opts.ReinitAfter = 0
+	}
+
+	if opts.MaxErrors < 0 {
+		opts.MaxErrors = 0
+	}
+
+	if opts.Pace < 0 {
+		opts.Pace = 0
+	}
+
+	if opts.Sweep != "" {
+		if opts.Profile != "" {
+			err = errors.New("sweep and profile can't be used together")
+			return
+		}
+
+		opts.sweep, err = parseSweep(opts.Sweep)
+		if err != nil {
+			return
+		}
+	}
+
+	for _, spec := range opts.Groups {
+		g, err := parseGroup(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		opts.groups = append(opts.groups, g)
+	}
+
+	opts.percentiles, err = parsePercentiles(opts.Percentiles)
+	if err != nil {
+		return
+	}
+
+	if opts.sweep != nil && len(opts.groups) > 0 {
+		err = errors.New("sweep and groups can't be used together")
+		return
+	}
+
+	if opts.sweep != nil && opts.Timeline != "" {
+		err = errors.New("sweep and timeline can't be used together")
+		return
+	}
+
+	opts.conf = opts.config()
+
+	switch opts.Interval {
+	case "":
+	case EXPECTED_INTERVAL_AUTO:
+		opts.conf.CorrectOmission = true
+	default:
+		opts.conf.ExpectedInterval, err = time.ParseDuration(opts.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("bad expected-interval %q, expected a duration or %s", opts.Interval, EXPECTED_INTERVAL_AUTO)
+		}
+	}
+
+	err = opts.conf.Validate()
+	if err != nil {
+		return
+	}
+
+	if opts.Profile != "" {
+		opts.Clients = opts.conf.MaxClients()
+		opts.Duration = int(math.Ceil(opts.conf.Duration.Seconds()))
+	}
+
+	if len(opts.groups) > 0 {
+		opts.Clients = opts.conf.Clients
+	}
+
+	return
+}
+
+// Translates the command-line arguments into a run configuration.
+func (this *AppConfig) config() knock.Config {
+	return knock.Config{
+		Clients:            this.Clients,
+		Duration:           time.Duration(this.Duration) * time.Second,
+		Warmup:             time.Duration(this.Warmup) * time.Second,
+		Cooldown:           time.Duration(this.Cooldown) * time.Second,
+		Ops:                this.Ops,
+		ClientOps:          this.ClientOps,
+		OpTimeout:          this.OpTimeout,
+		OnTimeout:          this.OnTimeout,
+		ReinitAfter:        this.ReinitAfter,
+		MaxErrors:          this.MaxErrors,
+		MaxErrorRate:       this.MaxErrorRate,
+		Rate:               this.Rate,
+		Arrival:            this.Arrival,
+		Think:              this.Think,
+		Pace:               this.Pace,
+		Profile:            this.Profile,
+		PerClientStats:     this.PerClientStats,
+		Properties:         this.Properties,
+		Seed:               this.Seed,
+		HistogramPrecision: this.Precision,
+		SummaryPercentile:  this.Rolling,
+		Groups:             this.knockGroups(),
+	}
+}
+
+// Whether the run stops after a number of operations.
+func (this *AppConfig) IsCounted() bool {
+	return this.Ops > 0 || this.ClientOps > 0
+}
+
+// The total wall-clock time of the run, including the warmup and
+// cooldown phases.
+func (this *AppConfig) runTime() time.Duration {
+	return this.conf.RunTime()
+}
+
+func (this *AppConfig) knockGroups() (groups []*knock.Group) {
+	for _, g := range this.groups {
+		groups = append(groups, g.group)
+	}
+
+	return
+}
+
+// A copy of the configuration for one round of a sweep.
+func (this *AppConfig) round(clients int) *AppConfig {
+	opts := *this
+	opts.Clients = clients
+	opts.conf.Clients = clients
+	opts.sweep = nil
+	return &opts
+}
@@ -0,0 +1,491 @@
+package cli
+
+import (
+	"github.com/dzrw/knock"
+	"testing"
+	"time"
+)
+
+func TestParseArguments(t *testing.T) {
+	args := []string{
+		"-c", "5",
+		"-d", "30",
+		"-v",
+		"-p", "a:1",
+		"-p", "b:2",
+		"--client-stats",
+		"--version",
+	}
+
+	opts, err := parseArgs(args)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !expectInt(t, 5, opts.Clients) {
+		return
+	}
+
+	if !expectInt(t, 30, opts.Duration) {
+		return
+	}
+
+	if !expectBool(t, true, opts.Verbose) {
+		return
+	}
+
+	if !expectBool(t, true, opts.PerClientStats) {
+		return
+	}
+
+	if !expectBool(t, true, opts.Version) {
+		return
+	}
+
+	if opts.Properties == nil {
+		t.Error("property map not initialized")
+		return
+	}
+
+	if !expectInt(t, 2, len(opts.Properties)) {
+		return
+	}
+
+	if !expectKeyValue(t, opts.Properties, "a", "1") {
+		return
+	}
+
+	if !expectKeyValue(t, opts.Properties, "b", "2") {
+		return
+	}
+}
+
+func TestEmptyArguments(t *testing.T) {
+	args := []string{}
+
+	_, err := parseArgs(args)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+}
+
+func TestDefaultValuesOfArguments(t *testing.T) {
+	args := []string{}
+
+	opts, err := parseArgs(args)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !expectInt(t, knock.MIN_LOAD, opts.Clients) {
+		return
+	}
+
+	if !expectInt(t, MIN_RUN_TIME, opts.Duration) {
+		return
+	}
+
+	if !expectBool(t, false, opts.Verbose) {
+		return
+	}
+
+	if !expectBool(t, false, opts.PerClientStats) {
+		return
+	}
+
+	if !expectBool(t, false, opts.Version) {
+		return
+	}
+
+	if !expectInt(t, 0, len(opts.Properties)) {
+		return
+	}
+}
+
+func TestLowerBoundsOfArguments(t *testing.T) {
+	args := []string{"-d", "0", "-c", "0"}
+
+	opts, err := parseArgs(args)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !expectInt(t, knock.MIN_LOAD, opts.Clients) {
+		return
+	}
+
+	if !expectInt(t, MIN_RUN_TIME, opts.Duration) {
+		return
+	}
+}
+
+func TestOpenLoopArguments(t *testing.T) {
+	args := []string{"--rate", "250", "--arrival", "poisson"}
+
+	opts, err := parseArgs(args)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !expectBool(t, true, opts.IsOpenLoop()) {
+		return
+	}
+
+	if !expectString(t, knock.ARRIVAL_POISSON, opts.Arrival) {
+		return
+	}
+
+	_, err = parseArgs([]string{"--rate", "250", "--arrival", "bursty"})
+	if err == nil {
+		t.Error("expected an error when arrival is not supported")
+		return
+	}
+}
+
+func TestPhaseArguments(t *testing.T) {
+	args := []string{"-d", "30", "--warmup", "10", "--cooldown", "5"}
+
+	opts, err := parseArgs(args)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !expectInt(t, 10, opts.Warmup) {
+		return
+	}
+
+	if !expectInt(t, 5, opts.Cooldown) {
+		return
+	}
+
+	if opts.runTime() != 45*time.Second {
+		t.Errorf("expected: %s, got: %s", 45*time.Second, opts.runTime())
+		return
+	}
+}
+
+func TestProfileArguments(t *testing.T) {
+	args := []string{"-c", "2", "-d", "60", "--profile", "hold 2s, ramp 2->16 over 1500ms"}
+
+	opts, err := parseArgs(args)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !expectInt(t, 16, opts.Clients) {
+		return
+	}
+
+	if !expectInt(t, 4, opts.Duration) {
+		return
+	}
+
+	if opts.conf.Duration != 3500*time.Millisecond {
+		t.Errorf("expected: %s, got: %s", 3500*time.Millisecond, opts.conf.Duration)
+		return
+	}
+}
+
+func TestCountedArguments(t *testing.T) {
+	opts, err := parseArgs([]string{"-n", "10000"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !expectBool(t, true, opts.IsCounted()) {
+		return
+	}
+
+	if !expectInt(t, 0, opts.Duration) {
+		return
+	}
+
+	if opts.conf.Duration != knock.UNLIMITED_RUN_TIME {
+		t.Errorf("expected an unlimited run time, got: %s", opts.conf.Duration)
+		return
+	}
+
+	opts, err = parseArgs([]string{"-n", "10000", "-d", "60"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !expectInt(t, 60, opts.Duration) {
+		return
+	}
+
+	// Without a duration, the measured phase never ends, so a
+	// cooldown would never start.
+	_, err = parseArgs([]string{"-n", "10000", "--cooldown", "5"})
+	if err == nil {
+		t.Error("expected an error for a cooldown without a duration")
+		return
+	}
+
+	_, err = parseArgs([]string{"-n", "10000", "-d", "60", "--cooldown", "5"})
+	if !expectOk(t, err) {
+		return
+	}
+}
+
+func TestThinkArguments(t *testing.T) {
+	opts, err := parseArgs([]string{"--think", "exp:10ms"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !expectString(t, "exp:10ms", opts.conf.Think) {
+		return
+	}
+
+	conflicts := [][]string{
+		{"--think", "5ms", "--pace", "10ms"},
+		{"--think", "5ms", "--rate", "100"},
+		{"--pace", "10ms", "--rate", "100"},
+	}
+
+	for _, args := range conflicts {
+		if _, err = parseArgs(args); err == nil {
+			t.Errorf("expected an error for %v", args)
+			return
+		}
+	}
+}
+
+func TestSeedArguments(t *testing.T) {
+	opts, err := parseArgs([]string{"--seed", "42"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if opts.conf.Seed != 42 {
+		t.Errorf("expected seed 42, got: %d", opts.conf.Seed)
+		return
+	}
+
+	opts, err = parseArgs([]string{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if opts.conf.Seed == 0 {
+		t.Error("expected a seed to be picked")
+		return
+	}
+}
+
+func TestGroupArguments(t *testing.T) {
+	opts, err := parseArgs([]string{
+		"-p", "mongodb.url:mongodb://localhost",
+		"--group", "writers:c=8,mongodb.run=writes",
+		"--group", "readers:clients=4,b=other,mongodb.run=counters",
+	})
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !expectInt(t, 12, opts.Clients) || !expectInt(t, 2, len(opts.conf.Groups)) {
+		return
+	}
+
+	w, r := opts.groups[0], opts.groups[1]
+
+	if !expectString(t, "writers", w.group.Name) || !expectInt(t, 8, w.group.Clients) {
+		return
+	}
+
+	if !expectString(t, "writes", w.group.Properties["mongodb.run"]) || !expectString(t, "", w.behavior) {
+		return
+	}
+
+	if !expectString(t, "readers", r.group.Name) || !expectInt(t, 4, r.group.Clients) {
+		return
+	}
+
+	if !expectString(t, "other", r.behavior) {
+		return
+	}
+
+	bad := [][]string{
+		{"--group", "writers"},
+		{"--group", "writers:c=0"},
+		{"--group", "writers:c"},
+		{"--group", "a:c=1", "--group", "a:c=2"},
+		{"--group", "a:c=1", "--sweep", "clients=1,2"},
+	}
+
+	for _, args := range bad {
+		if _, err = parseArgs(args); err == nil {
+			t.Errorf("expected an error for %v", args)
+			return
+		}
+	}
+}
+
+func TestSweepArguments(t *testing.T) {
+	opts, err := parseArgs([]string{"--sweep", "clients=1,2,4"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if opts.sweep == nil || !expectInt(t, 3, len(opts.sweep.levels)) {
+		return
+	}
+
+	if !expectInt(t, 4, opts.round(4).Clients) {
+		return
+	}
+
+	_, err = parseArgs([]string{"--sweep", "clients=1,2", "--profile", "hold 10s"})
+	if err == nil {
+		t.Error("expected an error when sweeping with a profile")
+		return
+	}
+}
+
+func TestBehaviorArguments(t *testing.T) {
+	opts, err := parseArgs([]string{"--behavior", "test.sleep"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !expectString(t, "test.sleep", opts.Behavior) {
+		return
+	}
+
+	knock.Register(&knock.BehaviorInfo{
+		Name:    "test.sleep",
+		Factory: func() knock.Behavior { return nil },
+	})
+
+	info, err := chooseBehavior(opts.Behavior)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !expectString(t, "test.sleep", info.Name) {
+		return
+	}
+
+	// The only registered behavior is the default.
+	info, err = chooseBehavior("")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !expectString(t, "test.sleep", info.Name) {
+		return
+	}
+
+	if _, err = chooseBehavior("test.missing"); err == nil {
+		t.Error("expected an error for an unknown behavior")
+		return
+	}
+}
+
+func TestPercentileArguments(t *testing.T) {
+	opts, err := parseArgs([]string{"--percentiles", "50, 90,99.9", "--summary-percentile", "99.9"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !expectInt(t, 3, len(opts.percentiles)) {
+		return
+	}
+
+	if opts.percentiles[0] != 50 || opts.percentiles[1] != 90 || opts.percentiles[2] != 99.9 {
+		t.Errorf("expected 50, 90 and 99.9, got: %v", opts.percentiles)
+		return
+	}
+
+	if opts.conf.SummaryPercentile != 99.9 {
+		t.Errorf("expected a summary percentile of 99.9, got: %f", opts.conf.SummaryPercentile)
+		return
+	}
+
+	for _, spec := range []string{"", "50,", "0", "101", "p99"} {
+		if _, err = parseArgs([]string{"--percentiles", spec}); err == nil {
+			t.Errorf("expected an error for %q", spec)
+			return
+		}
+	}
+
+	names := map[float64]string{1: "1st", 2: "2nd", 3: "3rd", 11: "11th", 50: "50th", 99.9: "99.9th", 100: "100th"}
+	for pct, name := range names {
+		if !expectString(t, name, percentileName(pct)) {
+			return
+		}
+	}
+}
+
+func TestExpectedIntervalArguments(t *testing.T) {
+	opts, err := parseArgs([]string{"--expected-interval", "2ms"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !expectBool(t, true, opts.conf.CorrectOmission) || opts.conf.ExpectedInterval != 2*time.Millisecond {
+		t.Errorf("expected an interval of 2ms, got: %s", opts.conf.ExpectedInterval)
+		return
+	}
+
+	opts, err = parseArgs([]string{"--expected-interval", "auto"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !expectBool(t, true, opts.conf.CorrectOmission) || opts.conf.ExpectedInterval != 0 {
+		t.Errorf("expected the interval to be derived, got: %s", opts.conf.ExpectedInterval)
+		return
+	}
+
+	bad := [][]string{
+		{"--expected-interval", "often"},
+		{"--expected-interval", "auto", "--rate", "100"},
+	}
+
+	for _, args := range bad {
+		if _, err = parseArgs(args); err == nil {
+			t.Errorf("expected an error for %v", args)
+			return
+		}
+	}
+}
+
+func TestTimelineArguments(t *testing.T) {
+	opts, err := parseArgs([]string{"--timeline", "out.csv"})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if !expectString(t, "out.csv", opts.Timeline) {
+		return
+	}
+
+	if _, err = parseArgs([]string{"--timeline", "out.csv", "--sweep", "clients=1,2"}); err == nil {
+		t.Error("expected an error for a sweep with a timeline")
+		return
+	}
+}
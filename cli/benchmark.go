@@ -0,0 +1,277 @@
+// Package cli is the knock command line, for binaries which bundle
+// their own behaviors alongside (or instead of) the built-in ones.
+package cli
+
+import (
+	"context"
+	"fmt"
+	"github.com/dzrw/knock"
+	goflags "github.com/jessevdk/go-flags"
+	"log"
+	"math/rand"
+	"os"
+	"os/signal"
+	"runtime"
+	"runtime/pprof"
+	"syscall"
+	"time"
+)
+
+// Parses the command line, and either lists the registered behaviors
+// (knock behaviors), or runs one of them.  Returns the exit status.
+func Main(args []string) int {
+	if len(args) > 0 && args[0] == "behaviors" {
+		printBehaviors(os.Stdout)
+		return 0
+	}
+
+	conf, err := parseArgs(args)
+	if err != nil {
+		// The flags parser has already said what was wrong.
+		if _, ok := err.(*goflags.Error); !ok {
+			fmt.Fprintf(os.Stderr, "knock: %v\n", err)
+		}
+
+		return 1
+	}
+
+	if conf.Version {
+		printVersion()
+		return 0
+	}
+
+	info, err := chooseBehavior(conf.Behavior)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "knock: %v\n", err)
+		return 1
+	}
+
+	conf.Behavior = info.Name
+	conf.conf.Fixture = info.Fixture
+
+	// Groups may run behaviors of their own.
+	for _, g := range conf.groups {
+		if g.behavior == "" {
+			continue
+		}
+
+		ginfo, err := chooseBehavior(g.behavior)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "knock: group %s: %v\n", g.group.Name, err)
+			return 1
+		}
+
+		g.group.Factory = ginfo.ContextFactory
+		g.group.Fixture = ginfo.Fixture
+	}
+
+	err = RunBenchmark(conf, info.ContextFactory)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "knock: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// Finds the named behavior, or the only one registered if no name
+// is given.
+func chooseBehavior(name string) (info *knock.BehaviorInfo, err error) {
+	if name != "" {
+		info, ok := knock.Lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown behavior %q (see: knock behaviors)", name)
+		}
+
+		return info, nil
+	}
+
+	infos := knock.Behaviors()
+	if len(infos) != 1 {
+		return nil, fmt.Errorf("choose one of the %d registered behaviors with --behavior (see: knock behaviors)", len(infos))
+	}
+
+	return infos[0], nil
+}
+
+// Runs the benchmark described by the command-line arguments, and
+// prints its report.  The first SIGINT or SIGTERM stops the benchmark
+// early, but still produces a report; a second one (or SIGQUIT) exits
+// immediately.
+func RunBenchmark(conf *AppConfig, factory knock.ContextBehaviorFactory) (err error) {
+	if conf.Version {
+		printVersion()
+		return
+	}
+
+	// If we're doing CPU profiling, we've got to set that up at
+	// the start.
+	if path, ok := conf.Profiles["cpu"]; ok {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+
+		pprof.StartCPUProfile(f)
+		defer pprof.StopCPUProfile()
+	}
+
+	// Likewise, a timeline which can't be written should stop the
+	// benchmark before it starts, rather than cost it its report.
+	var timeline *os.File
+	if conf.Timeline != "" {
+		timeline, err = os.Create(conf.Timeline)
+		if err != nil {
+			return fmt.Errorf("error creating the timeline: %v", err)
+		}
+	}
+
+	// Schedule all of the logical cores.
+	runtime.GOMAXPROCS(runtime.NumCPU())
+
+	// Seed the RNG (doesn't happen automatically).
+	rand.Seed(time.Now().UnixNano())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	notify(cancel)
+
+	if conf.sweep != nil {
+		return runSweep(ctx, conf, factory)
+	}
+
+	res, err := knock.RunContextBehavior(ctx, withSummaries(conf), factory)
+	if res == nil {
+		if timeline != nil {
+			timeline.Close()
+		}
+
+		return
+	}
+
+	writeProfiles(conf)
+	PrintReport(os.Stdout, res, conf)
+
+	if timeline != nil {
+		if err := writeTimeline(timeline, res); err != nil {
+			return fmt.Errorf("error writing the timeline: %v", err)
+		}
+	}
+
+	return
+}
+
+// Runs one round per load level, one after the other, and reports
+// them side by side.  An interrupt ends the current round early, and
+// skips the rest.
+func runSweep(ctx context.Context, conf *AppConfig, factory knock.ContextBehaviorFactory) (err error) {
+	rounds := []*sweepRound{}
+
+	for i, clients := range conf.sweep.levels {
+		if ctx.Err() != nil {
+			break
+		}
+
+		rc := conf.round(clients)
+
+		if conf.Verbose {
+			fmt.Fprintf(os.Stderr, "Round %d of %d, clients=%d\n", i+1, len(conf.sweep.levels), clients)
+		}
+
+		var res knock.Result
+		res, err = knock.RunContextBehavior(ctx, withSummaries(rc), factory)
+		if res == nil {
+			return
+		}
+
+		hist := res.Histogram2()
+
+		if conf.Verbose {
+			printSummaryTrailer(os.Stderr, res, hist, conf.percentiles)
+		}
+
+		rounds = append(rounds, &sweepRound{clients, res, hist})
+
+		// Report the rounds so far, but don't start another.
+		if err != nil {
+			break
+		}
+	}
+
+	writeProfiles(conf)
+	PrintSweepReport(os.Stdout, rounds, conf)
+	return
+}
+
+// The run configuration, printing a summary line per progress
+// interval when verbose.
+func withSummaries(conf *AppConfig) knock.Config {
+	rc := conf.conf
+
+	if conf.Verbose {
+		rc.OnSummary = func(evt *knock.SummaryEvent) {
+			printSummary(conf, evt)
+		}
+	}
+
+	return rc
+}
+
+// Cancels the benchmark on the first SIGINT or SIGTERM, and exits on
+// the next one (or on SIGQUIT).
+func notify(cancel func()) {
+	// Set up channel on which to send signal notifications.
+	// We must use a buffered channel or risk missing the signal
+	// if we're not ready to receive when the signal is sent.
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+
+	go func() {
+		interrupted := false
+
+		for sig := range ch {
+			switch sig {
+			case syscall.SIGQUIT:
+				os.Exit(1)
+
+			case syscall.SIGINT, syscall.SIGTERM:
+				if interrupted {
+					os.Exit(1)
+				}
+
+				interrupted = true
+				fmt.Fprintf(os.Stderr, "\nInterrupted, stopping clients (interrupt again to quit now)...\n")
+				cancel()
+			}
+		}
+	}()
+}
+
+func writeProfiles(conf *AppConfig) {
+	for name, v := range conf.Profiles {
+		if err := writeProfile(name, v); err != nil {
+			log.Fatalf("error writing %s profile: %v", name, err)
+		}
+	}
+}
+
+func writeProfile(name, path string) (err error) {
+	p := pprof.Lookup(name)
+	if p == nil {
+		return
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return
+	}
+
+	err = p.WriteTo(f, 0)
+	if err != nil {
+		return
+	}
+
+	f.Close()
+	return
+}
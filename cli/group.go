@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"fmt"
+	"github.com/dzrw/knock"
+	"strconv"
+	"strings"
+)
+
+// A group of clients given on the command line, e.g.
+//
+//	writers:c=8,mongodb.run=writes
+//
+// where c (or clients) is the number of clients, b (or behavior)
+// names the behavior if it isn't the run's own, and everything else
+// is a property.
+type groupSpec struct {
+	spec     string
+	behavior string
+	group    *knock.Group
+}
+
+func parseGroup(spec string) (this *groupSpec, err error) {
+	i := strings.Index(spec, ":")
+	if i <= 0 {
+		return nil, fmt.Errorf("bad group %q, expected: NAME:c=N,KEY=VALUE,...", spec)
+	}
+
+	this = &groupSpec{
+		spec: spec,
+		group: &knock.Group{
+			Name:       strings.TrimSpace(spec[:i]),
+			Clients:    knock.MIN_LOAD,
+			Properties: make(map[string]string),
+		},
+	}
+
+	for _, s := range strings.Split(spec[i+1:], ",") {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+
+		kv := strings.SplitN(s, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("bad setting %q in group %q, expected: KEY=VALUE", s, spec)
+		}
+
+		k, v := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+
+		switch k {
+		case "c", "clients":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < knock.MIN_LOAD {
+				return nil, fmt.Errorf("bad client count %q in group %q", v, spec)
+			}
+
+			this.group.Clients = n
+
+		case "b", "behavior":
+			this.behavior = v
+
+		default:
+			this.group.Properties[k] = v
+		}
+	}
+
+	return
+}
+
+func (this *groupSpec) String() string {
+	return this.spec
+}
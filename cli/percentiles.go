@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Parses a comma-separated list of percentiles, e.g.
+//
+//	50,90,99,99.9,99.99
+func parsePercentiles(spec string) (res []float64, err error) {
+	for _, s := range strings.Split(spec, ",") {
+		p, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil || p <= 0 || p > 100 {
+			return nil, fmt.Errorf("bad percentile %q in %q, expected a number from 0 to 100", s, spec)
+		}
+
+		res = append(res, p)
+	}
+
+	return
+}
+
+// Names a percentile the way the report does, e.g. 1st, 50th or 99.9th.
+func percentileName(p float64) string {
+	s := strconv.FormatFloat(p, 'f', -1, 64)
+
+	if p != float64(int(p)) || (int(p)%100)/10 == 1 {
+		return s + "th"
+	}
+
+	switch int(p) % 10 {
+	case 1:
+		return s + "st"
+	case 2:
+		return s + "nd"
+	case 3:
+		return s + "rd"
+	default:
+		return s + "th"
+	}
+}
@@ -0,0 +1,631 @@
+package cli
+
+import (
+	"fmt"
+	"github.com/dzrw/knock"
+	_ "log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type PrintFunc func(format string, args ...interface{})
+
+func PrintReport(f *os.File, s knock.Result, conf *AppConfig) {
+	p := fmt.Fprintf
+	//p := printer(f)
+
+	res := s.Histogram2()
+
+	if conf.Verbose {
+		printSummaryTrailer(os.Stderr, s, res, conf.percentiles)
+	}
+
+	printSetup(f, conf)
+
+	p(f, "Overview\n")
+	p(f, "--------\n")
+	p(f, "\n")
+	if s.Interrupted() {
+		p(f, "Interrupted: %s\n", s.StopReason())
+	}
+
+	p(f, "Run Time (s):\t%8.4f\n", s.RunTime().Seconds())
+	p(f, "Measured Time (s):\t%8.4f\n", s.MeasuredTime().Seconds())
+	p(f, "Operations:\t%d\n", s.Operations())
+	p(f, "Throughput (ops/sec):\t%f\n", s.Throughput())
+
+	if s.RequestBytes() > 0 || s.ResponseBytes() > 0 {
+		req, resp := s.Bandwidth()
+		p(f, "Bytes Sent:\t%d\n", s.RequestBytes())
+		p(f, "Bytes Received:\t%d\n", s.ResponseBytes())
+		p(f, "Bandwidth (MB/s):\t%f sent, %f received\n", megabytes(req), megabytes(resp))
+	}
+
+	p(f, "Mean Response Time:\t%s\n", wash(s.MeanResponseTime()))
+
+	if conf.Think != "" || conf.Pace > 0 {
+		p(f, "Mean Think Time:\t%s\n", wash(s.MeanThinkTime()))
+	}
+	p(f, "Load Efficiency (%%):\t%f\n", s.Efficiency())
+	p(f, "Errors: %d\n", s.Errors()[knock.WRK_ERROR])
+
+	if conf.OpTimeout > 0 {
+		p(f, "Timeouts: %d (%.4f%%)\n", s.Errors()[knock.WRK_TIMEOUT], 100*s.TimeoutRate())
+	}
+
+	if sched, ok := s.Schedule(); ok {
+		p(f, "Scheduled Ops: %d\n", sched.Scheduled)
+		p(f, "Late Ops (>%s behind schedule): %d\n", knock.ARRIVAL_LATE_THRESHOLD, sched.Late)
+		p(f, "Dropped Ops: %d\n", sched.Dropped)
+	}
+
+	p(f, "\n")
+
+	corrected, interval, ok := s.Corrected()
+	if ok {
+		p(f, "Expected Interval:\t%s\n", wash(interval))
+		p(f, "\n")
+	}
+
+	printDetails(f, res, corrected, s.FailedResponseTimes(), conf.percentiles)
+
+	for _, g := range s.Groups() {
+		printGroup(f, g, conf.percentiles)
+	}
+
+	if labels := s.Labels(); len(labels) > 0 {
+		printLabels(f, s, res, labels, conf.percentiles)
+	}
+
+	if metrics := s.Metrics(); len(metrics) > 0 {
+		printMetrics(f, metrics, conf.percentiles)
+	}
+
+	if timeline := s.Timeline(); len(timeline) > 0 {
+		printTimeline(f, timeline, res, conf)
+	}
+
+	p(f, "Response Time CDF and Frequency Histogram\n")
+	p(f, "-----------------------------------------\n")
+
+	// Every row is in the same unit, to keep the table easy to chart.
+	unit := unitOf(time.Duration(res.Median))
+
+	headers := []string{unit.name, "CDF", "total"}
+	if s.IsClientTrackingEnabled() {
+		for i := 0; i < conf.conf.MaxClients(); i++ {
+			headers = append(headers, fmt.Sprintf("client-%d", i))
+		}
+	}
+
+	rows := [][]string{}
+	for _, r := range res.Rows {
+		row := make([]string, len(r.Counts)+2)
+		row[0] = unit.format(time.Duration(r.Nsec))
+		row[1] = fmt.Sprintf("%2.6f", r.CDF)
+
+		for i, v := range r.Counts {
+			row[i+2] = strconv.Itoa(v)
+		}
+
+		rows = append(rows, row)
+	}
+
+	printTable(f, headers, rows)
+}
+
+// Prints a tab-delimited table, with a row of dashes under its
+// headers, ready to be pasted into a spreadsheet.
+func printTable(f *os.File, headers []string, rows [][]string) {
+	p := fmt.Fprintf
+
+	p(f, "(cut and paste the tab-delimited table below into Google Spreadsheets)")
+	p(f, "\n\n")
+
+	spacers := []string{}
+	for _, s := range headers {
+		spacers = append(spacers, strings.Repeat("-", len(s)))
+	}
+
+	p(f, strings.Join(headers, "\t"))
+	p(f, "\n")
+	p(f, strings.Join(spacers, "\t"))
+
+	for _, row := range rows {
+		p(f, "\n")
+		p(f, strings.Join(row, "\t"))
+	}
+
+	p(f, "\n")
+}
+
+// Prints the statistics of one group of clients; the overview above
+// covers every group combined.
+func printGroup(f *os.File, g *knock.GroupResult, percentiles []float64) {
+	p := fmt.Fprintf
+
+	title := "Group: " + g.Name
+	p(f, "%s\n", title)
+	p(f, "%s\n", strings.Repeat("-", len(title)))
+	p(f, "\n")
+	p(f, "Clients:\t%d\n", g.Clients)
+	p(f, "Operations:\t%d\n", g.Operations)
+	p(f, "Throughput (ops/sec):\t%f\n", g.Throughput)
+	p(f, "Mean Response Time:\t%s\n", wash(g.MeanResponseTime))
+	p(f, "Errors: %d\n", g.Errors[knock.WRK_ERROR])
+	p(f, "\n")
+
+	printDetails(f, g.Histogram, nil, g.Failed, percentiles)
+}
+
+// Prints the descriptive statistics of a response time distribution,
+// and the chosen percentiles.  If the distribution has been corrected
+// for coordinated omission, the corrected statistics are shown next
+// to the measured ones.  The response times of the failed operations
+// follow, with their counts.
+func printDetails(f *os.File, res, corrected *knock.HistogramResult, failed map[knock.WorkResult]*knock.HistogramResult, percentiles []float64) {
+	p := fmt.Fprintf
+
+	line := func(name string, measured, correct float64) {
+		p(f, "  %s: %s", name, wash(time.Duration(measured)))
+		if corrected != nil {
+			p(f, "\t(corrected: %s)", wash(time.Duration(correct)))
+		}
+
+		p(f, "\n")
+	}
+
+	// Without a correction, the measured statistics stand in for the
+	// corrected ones, which aren't shown.
+	c := corrected
+	if c == nil {
+		c = res
+	}
+
+	p(f, "Response Time Details:\n")
+	line("Min", float64(res.Min), float64(c.Min))
+	line("Max", float64(res.Max), float64(c.Max))
+	line("Mean", res.Mean, c.Mean)
+	line("Median", float64(res.Median), float64(c.Median))
+	line("Standard Deviation", res.StdDev, c.StdDev)
+
+	p(f, "  Coefficient of Variation: %f", res.CV)
+	if corrected != nil {
+		p(f, "\t(corrected: %f)", c.CV)
+	}
+
+	p(f, "\n")
+
+	for _, pct := range percentiles {
+		line(percentileName(pct)+" Percentile", float64(res.Percentile(pct)), float64(c.Percentile(pct)))
+	}
+
+	total := res.Count
+	for _, h := range failed {
+		total += h.Count
+	}
+
+	for _, status := range []knock.WorkResult{knock.WRK_ERROR, knock.WRK_TIMEOUT} {
+		h, ok := failed[status]
+		if !ok {
+			continue
+		}
+
+		p(f, "  %s: %d (%.4f%%), Mean: %s, Max: %s\n", failureNames[status],
+			h.Count, 100*float64(h.Count)/float64(total), wash(time.Duration(h.Mean)), wash(time.Duration(h.Max)))
+	}
+
+	p(f, "\n\n")
+}
+
+// How the report names the failed operations.
+var failureNames = map[knock.WorkResult]string{
+	knock.WRK_ERROR:   "Errors",
+	knock.WRK_TIMEOUT: "Timeouts",
+}
+
+// Prints one row per labeled type of operation, followed by the
+// combined totals.
+func printLabels(f *os.File, s knock.Statistics, res *knock.HistogramResult, labels []*knock.LabelResult, percentiles []float64) {
+	p := fmt.Fprintf
+
+	p(f, "Operations by Label\n")
+	p(f, "-------------------\n")
+	unit := unitOf(time.Duration(res.Median))
+
+	headers := []string{"label", "ops", "ops/sec", "mean (" + unit.name + ")"}
+	for _, pct := range percentiles {
+		headers = append(headers, percentileName(pct)+" ("+unit.name+")")
+	}
+
+	headers = append(headers, "errors")
+
+	rows := [][]string{}
+	for _, l := range labels {
+		row := []string{
+			l.Label,
+			strconv.FormatInt(l.Operations, 10),
+			fmt.Sprintf("%f", l.Throughput),
+			unit.format(l.MeanResponseTime),
+		}
+
+		row = append(row, percentileCells(l.Histogram, percentiles, unit)...)
+		row = append(row, strconv.Itoa(l.Errors[knock.WRK_ERROR]))
+		rows = append(rows, row)
+	}
+
+	total := []string{
+		"(total)",
+		strconv.FormatInt(s.Operations(), 10),
+		fmt.Sprintf("%f", s.Throughput()),
+		unit.format(s.MeanResponseTime()),
+	}
+
+	total = append(total, percentileCells(res, percentiles, unit)...)
+	total = append(total, strconv.Itoa(s.Errors()[knock.WRK_ERROR]))
+	rows = append(rows, total)
+
+	printTable(f, headers, rows)
+	p(f, "\n\n")
+}
+
+// Prints one row per progress interval, so that throughput dips and
+// latency spikes stand out.
+func printTimeline(f *os.File, timeline []*knock.IntervalResult, res *knock.HistogramResult, conf *AppConfig) {
+	p := fmt.Fprintf
+
+	p(f, "Timeline\n")
+	p(f, "--------\n")
+	unit := unitOf(time.Duration(res.Median))
+
+	headers := []string{"elapsed (s)", "ops", "ops/sec"}
+	for _, name := range []string{"mean", "50th", "99th", "max"} {
+		headers = append(headers, name+" ("+unit.name+")")
+	}
+
+	headers = append(headers, "errors")
+	if conf.OpTimeout > 0 {
+		headers = append(headers, "timeouts")
+	}
+
+	headers = append(headers, "clients")
+
+	rows := [][]string{}
+	for _, r := range timeline {
+		row := []string{
+			fmt.Sprintf("%.3f", r.Elapsed.Seconds()),
+			strconv.FormatInt(r.Operations, 10),
+			fmt.Sprintf("%f", r.Throughput),
+			unit.format(r.MeanResponseTime),
+			unit.format(r.P50),
+			unit.format(r.P99),
+			unit.format(r.Max),
+			strconv.Itoa(r.Errors[knock.WRK_ERROR]),
+		}
+
+		if conf.OpTimeout > 0 {
+			row = append(row, strconv.Itoa(r.Errors[knock.WRK_TIMEOUT]))
+		}
+
+		row = append(row, strconv.Itoa(r.Clients))
+		rows = append(rows, row)
+	}
+
+	printTable(f, headers, rows)
+	p(f, "\n\n")
+}
+
+// The chosen percentiles of a distribution, as table cells.
+func percentileCells(res *knock.HistogramResult, percentiles []float64, unit timeUnit) (cells []string) {
+	for _, pct := range percentiles {
+		cells = append(cells, unit.format(time.Duration(res.Percentile(pct))))
+	}
+
+	return
+}
+
+// Prints the behavior's own counters, gauges and histograms.
+func printMetrics(f *os.File, metrics []*knock.MetricResult, percentiles []float64) {
+	p := fmt.Fprintf
+
+	p(f, "Behavior Metrics\n")
+	p(f, "----------------\n")
+	p(f, "\n")
+
+	for _, m := range metrics {
+		switch m.Kind {
+		case knock.METRIC_COUNTER:
+			p(f, "%s (counter): %d (%f/sec)\n", m.Name, m.Count, m.Rate)
+
+		case knock.METRIC_GAUGE:
+			p(f, "%s (gauge): %f [mean: %f, min: %f, max: %f]\n", m.Name, m.Value, m.Mean, m.Min, m.Max)
+
+		case knock.METRIC_HISTOGRAM:
+			h := m.Histogram
+			stats := []string{fmt.Sprintf("mean: %f", m.Mean), fmt.Sprintf("stddev: %f", h.StdDev), fmt.Sprintf("min: %d", h.Min)}
+			for _, pct := range percentiles {
+				stats = append(stats, fmt.Sprintf("%s: %d", percentileName(pct), h.Percentile(pct)))
+			}
+
+			stats = append(stats, fmt.Sprintf("max: %d", h.Max))
+			p(f, "%s (histogram): %d values [%s]\n", m.Name, m.Count, strings.Join(stats, ", "))
+		}
+	}
+
+	p(f, "\n\n")
+}
+
+func printSetup(f *os.File, conf *AppConfig) {
+	p := fmt.Fprintf
+
+	p(f, "Setup\n")
+	p(f, "-----\n")
+	p(f, "\n")
+	if conf.Behavior != "" {
+		p(f, "behavior=%s\n", conf.Behavior)
+	}
+
+	if conf.sweep != nil {
+		p(f, "sweep=%s\n", conf.sweep)
+	} else {
+		p(f, "clients=%d\n", conf.Clients)
+	}
+
+	for _, g := range conf.groups {
+		p(f, "group=%s\n", g)
+	}
+
+	p(f, "duration=%d\n", conf.Duration)
+	if conf.IsCounted() {
+		p(f, "ops=%d\n", conf.Ops)
+		p(f, "client-ops=%d\n", conf.ClientOps)
+	}
+
+	p(f, "seed=%d\n", conf.conf.Seed)
+	p(f, "precision=%d\n", conf.conf.HistogramPrecision)
+	p(f, "percentiles=%s\n", conf.Percentiles)
+
+	if conf.Think != "" {
+		p(f, "think=%s\n", conf.Think)
+	}
+
+	if conf.Pace > 0 {
+		p(f, "pace=%s\n", conf.Pace)
+	}
+
+	if conf.ReinitAfter > 0 {
+		p(f, "reinit-after=%d\n", conf.ReinitAfter)
+	}
+
+	if conf.Timeline != "" {
+		p(f, "timeline=%s\n", conf.Timeline)
+	}
+
+	if conf.Interval != "" {
+		p(f, "expected-interval=%s\n", conf.Interval)
+	}
+
+	if conf.MaxErrors > 0 {
+		p(f, "max-errors=%d\n", conf.MaxErrors)
+	}
+
+	if conf.MaxErrorRate > 0 {
+		p(f, "max-error-rate=%f\n", conf.MaxErrorRate)
+	}
+
+	if conf.OpTimeout > 0 {
+		p(f, "op-timeout=%s\n", conf.OpTimeout)
+		p(f, "on-timeout=%s\n", conf.OnTimeout)
+	}
+
+	p(f, "warmup=%d\n", conf.Warmup)
+	p(f, "cooldown=%d\n", conf.Cooldown)
+
+	if conf.Profile != "" {
+		p(f, "profile=%s\n", conf.Profile)
+	}
+
+	if conf.IsOpenLoop() {
+		p(f, "rate=%f\n", conf.Rate)
+		p(f, "arrival=%s\n", conf.Arrival)
+	}
+
+	for k, v := range conf.Properties {
+		p(f, "%s=%s\n", k, v)
+	}
+	p(f, "\n\n")
+}
+
+// Prints one row per round of a sweep, followed by the knee of the
+// throughput vs. latency curve.
+func PrintSweepReport(f *os.File, rounds []*sweepRound, conf *AppConfig) {
+	p := fmt.Fprintf
+
+	printSetup(f, conf)
+
+	p(f, "Throughput vs. Response Time\n")
+	p(f, "----------------------------\n")
+	// The unit suits the lightest load, which is usually the fastest.
+	unit := unitOf(0)
+	if len(rounds) > 0 {
+		unit = unitOf(time.Duration(rounds[0].hist.Median))
+	}
+
+	percentiles := withSweepPercentiles(conf.percentiles)
+
+	headers := []string{"clients", "ops/sec", "mean (" + unit.name + ")"}
+	for _, pct := range percentiles {
+		headers = append(headers, percentileName(pct)+" ("+unit.name+")")
+	}
+
+	headers = append(headers, "efficiency", "errors")
+	if conf.OpTimeout > 0 {
+		headers = append(headers, "timeouts")
+	}
+
+	rows := [][]string{}
+	for _, r := range rounds {
+		row := []string{
+			strconv.Itoa(r.clients),
+			fmt.Sprintf("%f", r.stats.Throughput()),
+			unit.format(r.stats.MeanResponseTime()),
+		}
+
+		row = append(row, percentileCells(r.hist, percentiles, unit)...)
+		row = append(row,
+			fmt.Sprintf("%f", r.stats.Efficiency()),
+			strconv.Itoa(r.stats.Errors()[knock.WRK_ERROR]))
+
+		if conf.OpTimeout > 0 {
+			row = append(row, strconv.Itoa(r.stats.Errors()[knock.WRK_TIMEOUT]))
+		}
+
+		if r.stats.Interrupted() {
+			row = append(row, "(interrupted)")
+		}
+
+		rows = append(rows, row)
+	}
+
+	printTable(f, headers, rows)
+	p(f, "\n")
+
+	if i, ok := knee(rounds); ok {
+		k := rounds[i]
+		p(f, "Knee: clients=%d, Throughput (ops/sec): %f, Mean Response Time: %s\n",
+			k.clients, k.stats.Throughput(), wash(k.stats.MeanResponseTime()))
+	} else {
+		p(f, "Knee: not reached\n")
+	}
+}
+
+func printSummary(conf *AppConfig, evt *knock.SummaryEvent) {
+	const format = "\015Runtime: %4.fs%s, Throughput (ops/sec): %8.3f, Response Time: %10s, Efficiency (%%): %2.3f"
+	const format2 = ", Clients: %4d"
+	const format3 = ", Bandwidth (MB/s): %8.3f sent, %8.3f received"
+	const format4 = ", %s: %10s"
+
+	running := evt.Elapsed
+
+	fmt.Fprintf(os.Stderr, format,
+		running.Seconds(), phase(conf, running), evt.OpsPerSecond, wash(evt.MeanResponseTime), evt.Efficiency)
+
+	fmt.Fprintf(os.Stderr, format4, percentileName(evt.Percentile), wash(evt.PercentileResponseTime))
+
+	if evt.RequestBytesPerSecond > 0 || evt.ResponseBytesPerSecond > 0 {
+		fmt.Fprintf(os.Stderr, format3, megabytes(evt.RequestBytesPerSecond), megabytes(evt.ResponseBytesPerSecond))
+	}
+
+	if conf.Profile != "" {
+		fmt.Fprintf(os.Stderr, format2, evt.Clients)
+	}
+}
+
+// Labels the unmeasured phases of the run for the summary line.
+// The labels are padded to the same width, since each summary
+// overwrites the previous one.
+func phase(conf *AppConfig, running time.Duration) string {
+	switch {
+	case conf.conf.Warmup == 0 && conf.conf.Cooldown == 0:
+		return ""
+	case running < conf.conf.Warmup:
+		return " (warmup)  "
+	case running >= conf.conf.Warmup+conf.conf.Duration && conf.conf.Cooldown > 0:
+		return " (cooldown)"
+	default:
+		return "           "
+	}
+}
+
+func printSummaryTrailer(f *os.File, s knock.Statistics, res *knock.HistogramResult, percentiles []float64) {
+	p := fmt.Fprintf
+
+	status := ""
+	if s.Interrupted() {
+		status = " (interrupted)"
+	}
+
+	p(f, "\n")
+	stats := []string{}
+	for _, pct := range percentiles {
+		stats = append(stats, fmt.Sprintf("%s: %s", percentileName(pct), wash(time.Duration(res.Percentile(pct)))))
+	}
+
+	p(f, "Time's up!%s Errors: %d, Timeouts: %d, Fastest: %s, Median: %s, Percentiles: [%s], Slowest: %s, Std Dev: %s, CV: %.3f",
+		status, s.Errors()[knock.WRK_ERROR], s.Errors()[knock.WRK_TIMEOUT], wash(time.Duration(res.Min)), wash(time.Duration(res.Median)),
+		strings.Join(stats, ", "), wash(time.Duration(res.Max)), wash(time.Duration(res.StdDev)), res.CV)
+
+	p(f, "\n")
+}
+
+func megabytes(bytes float64) float64 {
+	return bytes / 1e6
+}
+
+// Shows a time in the unit which suits it, e.g. 850ns, 1.250ms or
+// 2.000s.
+func wash(d time.Duration) string {
+	unit := unitOf(d)
+	return unit.format(d) + unit.name
+}
+
+// A unit in which to show times.
+type timeUnit struct {
+	name string
+	size time.Duration
+}
+
+var timeUnits = []timeUnit{
+	{"s", time.Second},
+	{"ms", time.Millisecond},
+	{"μs", time.Microsecond},
+	{"ns", time.Nanosecond},
+}
+
+// The largest unit of which a time is at least one.
+func unitOf(d time.Duration) timeUnit {
+	for _, unit := range timeUnits {
+		if d >= unit.size {
+			return unit
+		}
+	}
+
+	return timeUnits[len(timeUnits)-1]
+}
+
+// Shows a time as a number of units, without the unit's name.
+func (this timeUnit) format(d time.Duration) string {
+	if this.size == time.Nanosecond {
+		return strconv.FormatInt(int64(d), 10)
+	}
+
+	return fmt.Sprintf("%.3f", float64(d)/float64(this.size))
+}
+
+// Lists the registered behaviors, and the properties they accept.
+func printBehaviors(f *os.File) {
+	p := fmt.Fprintf
+
+	for _, info := range knock.Behaviors() {
+		p(f, "%s\n", info.Name)
+		p(f, "    %s\n", info.Description)
+
+		for _, prop := range info.Properties {
+			if prop.Default != "" {
+				p(f, "    -p %-24s %s (%s)\n", prop.Name+":", prop.Description, prop.Default)
+			} else {
+				p(f, "    -p %-24s %s\n", prop.Name+":", prop.Description)
+			}
+		}
+
+		p(f, "\n")
+	}
+}
+
+func printVersion() {
+	const format = "knock version %s"
+	fmt.Fprintf(os.Stdout, format, knock.VERSION)
+	fmt.Fprintf(os.Stdout, "\n")
+}
@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWash(t *testing.T) {
+	washed := map[time.Duration]string{
+		0:                       "0ns",
+		850 * time.Nanosecond:   "850ns",
+		1250 * time.Nanosecond:  "1.250μs",
+		999 * time.Microsecond:  "999.000μs",
+		1500 * time.Microsecond: "1.500ms",
+		2 * time.Second:         "2.000s",
+	}
+
+	for d, s := range washed {
+		if !expectString(t, s, wash(d)) {
+			return
+		}
+	}
+
+	// A table keeps to one unit, however small its values.
+	unit := unitOf(1500 * time.Microsecond)
+	if !expectString(t, "ms", unit.name) || !expectString(t, "0.850", unit.format(850*time.Microsecond)) {
+		return
+	}
+}
+
+func TestPrintTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "table.txt")
+
+	f, err := os.Create(path)
+	if !expectOk(t, err) {
+		return
+	}
+
+	printTable(f, []string{"clients", "ops/sec"}, [][]string{{"1", "10.5"}, {"2", "19.8"}})
+	f.Close()
+
+	b, err := os.ReadFile(path)
+	if !expectOk(t, err) {
+		return
+	}
+
+	expected := "(cut and paste the tab-delimited table below into Google Spreadsheets)\n\n" +
+		"clients\tops/sec\n" +
+		"-------\t-------\n" +
+		"1\t10.5\n" +
+		"2\t19.8\n"
+
+	if !expectString(t, expected, string(b)) {
+		return
+	}
+}
@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"fmt"
+	"github.com/dzrw/knock"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	SWEEP_CLIENTS = "clients"
+)
+
+// The percentiles a sweep always reports, whatever --percentiles says,
+// alongside the mean the knee is found from.
+var sweepPercentiles = []float64{95, 99}
+
+// A series of rounds, each run at a different load level, e.g.
+//
+//	clients=1,2,4,8,16,32,64
+type loadSweep struct {
+	spec   string
+	param  string
+	levels []int
+}
+
+func parseSweep(spec string) (this *loadSweep, err error) {
+	i := strings.Index(spec, "=")
+	if i < 0 {
+		return nil, fmt.Errorf("bad sweep %q, expected: clients=N,N,...", spec)
+	}
+
+	this = &loadSweep{
+		spec:  spec,
+		param: strings.TrimSpace(spec[:i]),
+	}
+
+	if this.param != SWEEP_CLIENTS {
+		return nil, fmt.Errorf("bad sweep %q, only clients can be swept", spec)
+	}
+
+	for _, s := range strings.Split(spec[i+1:], ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || n < knock.MIN_LOAD {
+			return nil, fmt.Errorf("bad sweep level %q in %q", s, spec)
+		}
+
+		this.levels = append(this.levels, n)
+	}
+
+	return
+}
+
+func (this *loadSweep) String() string {
+	return this.spec
+}
+
+// The results of one round of a sweep.
+type sweepRound struct {
+	clients int
+	stats   knock.Result
+	hist    *knock.HistogramResult
+}
+
+// Finds the knee of the throughput vs. latency curve, i.e. the last
+// load level before the mean response time starts to grow faster than
+// the throughput does.  Returns false if latency never outpaces
+// throughput over the rounds given.
+func knee(rounds []*sweepRound) (i int, ok bool) {
+	for j := 1; j < len(rounds); j += 1 {
+		prev, curr := rounds[j-1].stats, rounds[j].stats
+
+		if prev.Throughput() <= 0 || prev.MeanResponseTime() <= 0 {
+			continue
+		}
+
+		throughput := curr.Throughput()/prev.Throughput() - 1
+		latency := float64(curr.MeanResponseTime())/float64(prev.MeanResponseTime()) - 1
+
+		if latency > throughput {
+			return j - 1, true
+		}
+	}
+
+	return
+}
+
+// Adds the percentiles a sweep always reports to those chosen, in
+// ascending order and without duplicates.
+func withSweepPercentiles(percentiles []float64) (res []float64) {
+	all := append(append([]float64{}, percentiles...), sweepPercentiles...)
+	sort.Float64s(all)
+
+	for i, pct := range all {
+		if i == 0 || pct != all[i-1] {
+			res = append(res, pct)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"fmt"
+	"github.com/dzrw/knock"
+	"testing"
+	"time"
+)
+
+func TestParseSweep(t *testing.T) {
+	ls, err := parseSweep("clients=1, 2,4,8")
+	if !expectOk(t, err) {
+		return
+	}
+
+	if !expectString(t, SWEEP_CLIENTS, ls.param) {
+		return
+	}
+
+	if !expectInt(t, 4, len(ls.levels)) {
+		return
+	}
+
+	if !expectInt(t, 8, ls.levels[3]) {
+		return
+	}
+
+	for _, spec := range []string{"", "clients", "clients=", "clients=1,0", "rate=100,200"} {
+		if _, err := parseSweep(spec); err == nil {
+			t.Errorf("expected an error for sweep %q", spec)
+			return
+		}
+	}
+}
+
+// Only knows its throughput and mean response time.
+type fixed_statistics struct {
+	knock.Result
+	throughput   float64
+	responseTime time.Duration
+}
+
+func (this *fixed_statistics) Throughput() float64 {
+	return this.throughput
+}
+
+func (this *fixed_statistics) MeanResponseTime() time.Duration {
+	return this.responseTime
+}
+
+func TestSweepPercentiles(t *testing.T) {
+	for spec, expected := range map[string]string{
+		"5,95,99,99.9": "[5 95 99 99.9]",
+		"50,99.9":      "[50 95 99 99.9]",
+		"99,90":        "[90 95 99]",
+	} {
+		percentiles, err := parsePercentiles(spec)
+		if !expectOk(t, err) {
+			return
+		}
+
+		if !expectString(t, expected, fmt.Sprint(withSweepPercentiles(percentiles))) {
+			return
+		}
+	}
+}
+
+func TestSweepKnee(t *testing.T) {
+	rounds := []*sweepRound{
+		{clients: 1, stats: &fixed_statistics{throughput: 1000, responseTime: 1000}},
+		{clients: 2, stats: &fixed_statistics{throughput: 1950, responseTime: 1020}},
+		{clients: 4, stats: &fixed_statistics{throughput: 3600, responseTime: 1100}},
+		{clients: 8, stats: &fixed_statistics{throughput: 4000, responseTime: 2000}},
+		{clients: 16, stats: &fixed_statistics{throughput: 4100, responseTime: 3900}},
+	}
+
+	i, ok := knee(rounds)
+	if !expectBool(t, true, ok) {
+		return
+	}
+
+	if !expectInt(t, 4, rounds[i].clients) {
+		return
+	}
+
+	_, ok = knee(rounds[:3])
+	if !expectBool(t, false, ok) {
+		return
+	}
+}
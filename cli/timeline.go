@@ -0,0 +1,41 @@
+package cli
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/dzrw/knock"
+	"os"
+	"strconv"
+)
+
+// Writes the statistics of each progress interval to a CSV file, one
+// row per interval, with the times in nanoseconds, and closes it.
+func writeTimeline(f *os.File, s knock.Statistics) (err error) {
+	defer func() {
+		if e := f.Close(); e != nil && err == nil {
+			err = e
+		}
+	}()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"elapsed_s", "duration_s", "ops", "ops_per_sec", "mean_ns", "p50_ns", "p99_ns", "max_ns", "errors", "timeouts", "clients"})
+
+	for _, r := range s.Timeline() {
+		w.Write([]string{
+			fmt.Sprintf("%.3f", r.Elapsed.Seconds()),
+			fmt.Sprintf("%.3f", r.Duration.Seconds()),
+			strconv.FormatInt(r.Operations, 10),
+			fmt.Sprintf("%f", r.Throughput),
+			strconv.FormatInt(int64(r.MeanResponseTime), 10),
+			strconv.FormatInt(int64(r.P50), 10),
+			strconv.FormatInt(int64(r.P99), 10),
+			strconv.FormatInt(int64(r.Max), 10),
+			strconv.Itoa(r.Errors[knock.WRK_ERROR]),
+			strconv.Itoa(r.Errors[knock.WRK_TIMEOUT]),
+			strconv.Itoa(r.Clients),
+		})
+	}
+
+	w.Flush()
+	return w.Error()
+}
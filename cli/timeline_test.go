@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"github.com/dzrw/knock"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Only knows its timeline.
+type timeline_statistics struct {
+	knock.Result
+	timeline []*knock.IntervalResult
+}
+
+func (this *timeline_statistics) Timeline() []*knock.IntervalResult {
+	return this.timeline
+}
+
+func TestWriteTimeline(t *testing.T) {
+	s := &timeline_statistics{timeline: []*knock.IntervalResult{
+		{
+			Elapsed:          time.Second,
+			Duration:         time.Second,
+			Operations:       1000,
+			Throughput:       1000,
+			MeanResponseTime: 1500 * time.Microsecond,
+			P50:              time.Millisecond,
+			P99:              5 * time.Millisecond,
+			Max:              8 * time.Millisecond,
+			Errors:           map[knock.WorkResult]int{knock.WRK_ERROR: 3},
+			Clients:          4,
+		},
+		{
+			Elapsed:  1500 * time.Millisecond,
+			Duration: 500 * time.Millisecond,
+			Errors:   map[knock.WorkResult]int{knock.WRK_TIMEOUT: 2},
+			Clients:  8,
+		},
+	}}
+
+	path := filepath.Join(t.TempDir(), "timeline.csv")
+	f, err := os.Create(path)
+	if !expectOk(t, err) {
+		return
+	}
+
+	if err := writeTimeline(f, s); err != nil {
+		t.Error(err)
+		return
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if !expectInt(t, 3, len(lines)) {
+		return
+	}
+
+	if !expectString(t, "1.000,1.000,1000,1000.000000,1500000,1000000,5000000,8000000,3,0,4", lines[1]) {
+		return
+	}
+
+	if !expectString(t, "1.500,0.500,0,0.000000,0,0,0,0,0,2,8", lines[2]) {
+		return
+	}
+}
+
+func TestRunBenchmarkCreatesTimelineFirst(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "timeline.csv")
+
+	conf, err := parseArgs([]string{"-d1", "--timeline", path})
+	if !expectOk(t, err) {
+		return
+	}
+
+	started := false
+	err = RunBenchmark(conf, func() knock.ContextBehavior {
+		started = true
+		return nil
+	})
+
+	if err == nil {
+		t.Error("expected an error for a timeline which can't be created")
+		return
+	}
+
+	if !expectBool(t, false, started) {
+		return
+	}
+}
@@ -0,0 +1,12 @@
+package main
+
+import (
+	_ "github.com/dzrw/knock/behaviors/mongodb"
+	"github.com/dzrw/knock/cli"
+	"os"
+)
+
+func main() {
+	// Run whichever registered behavior the command line asks for.
+	os.Exit(cli.Main(os.Args[1:]))
+}
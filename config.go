@@ -0,0 +1,337 @@
+package knock
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	MIN_LOAD = 1
+
+	// Runs which stop on an operation count don't need a time
+	// limit, but still need a finite duration.
+	UNLIMITED_RUN_TIME = 100 * 365 * 24 * time.Hour
+
+	// The percentile of the response times which each progress
+	// summary reports, unless it's told otherwise.
+	DEFAULT_SUMMARY_PERCENTILE = 99
+)
+
+// Describes a run.  Only Clients and one of Duration, Ops, ClientOps
+// or Profile are required; everything else has a sensible zero value.
+type Config struct {
+	// The number of clients, or the initial number when following
+	// a load profile.
+	Clients int
+
+	// How long to measure for, not counting the warmup and cooldown
+	// phases.  A counted run without a duration lasts until its
+	// budget has been spent.
+	Duration time.Duration
+	Warmup   time.Duration
+	Cooldown time.Duration
+
+	// Stop after this many successful operations in total, or per
+	// client.
+	Ops       int
+	ClientOps int
+
+	// Give up on operations which take longer than this, and either
+	// reinit the behavior (TIMEOUT_REINIT) or keep it and wait for
+	// the operation before starting the next one (TIMEOUT_ABANDON).
+	OpTimeout time.Duration
+	OnTimeout string
+
+	// Re-initialize a behavior after this many consecutive errors.
+	ReinitAfter int
+
+	// Abort the run once more than this many, or this fraction, of
+	// the operations have failed.
+	MaxErrors    int
+	MaxErrorRate float64
+
+	// Issue operations open-loop at this many ops/sec, on an
+	// ARRIVAL_FIXED or ARRIVAL_POISSON schedule.
+	Rate    float64
+	Arrival string
+
+	// Pause between closed-loop operations (see parseThinkTime), or
+	// start them this far apart.
+	Think string
+	Pace  time.Duration
+
+	// Vary the number of clients over time (see parseProfile).  The
+	// profile decides the duration of the run.
+	Profile string
+
+	PerClientStats bool
+	Properties     map[string]string
+
+	// The number of significant digits which the response time
+	// histograms keep, from 1 to 5 (see Histogram).
+	HistogramPrecision int
+
+	// The percentile of each progress interval's response times
+	// which its summary reports, e.g. 99.  Zero means 99.
+	SummaryPercentile float64
+
+	// Corrects the response times for coordinated omission (see
+	// Histogram.Corrected), assuming each client means to start an
+	// operation every ExpectedInterval.  A zero interval is derived
+	// from the run: the pace, if there is one, or else the median
+	// response time plus the mean think time.  Setting an interval
+	// turns the correction on.  Open-loop runs don't need it, since
+	// they already measure from each operation's intended start.
+	CorrectOmission  bool
+	ExpectedInterval time.Duration
+
+	// Seeds each client's Env.Rand.  A zero seed is replaced with
+	// one drawn from the clock.
+	Seed int64
+
+	// Called with a summary of the run so far, once per progress
+	// interval.
+	OnSummary func(evt *SummaryEvent)
+
+	// Sets up before the run, and tears down after it.  With groups,
+	// it's set up once for each group which runs the run's behavior,
+	// with the group's properties.
+	Fixture Fixture
+
+	// Runs several groups of clients side by side, each with its own
+	// properties, and perhaps its own behavior.  The clients are
+	// numbered through the groups in order, and Clients becomes their
+	// total.
+	Groups []*Group
+
+	profile       *loadProfile
+	think         *thinkTime
+	fixtureValue  interface{}
+	groupFixtures map[*Group]interface{}
+}
+
+// A group of clients which share their properties and behavior.
+type Group struct {
+	Name    string
+	Clients int
+
+	// Added to the run's properties, replacing any with the same
+	// name.
+	Properties map[string]string
+
+	// The behavior to run, or nil for the run's own.
+	Factory ContextBehaviorFactory
+
+	// Sets up before the run, and tears down after it, for the
+	// group's own behavior.  A group which runs the run's behavior
+	// uses the run's Fixture instead.
+	Fixture Fixture
+}
+
+// Checks the configuration, and fills in the defaults.
+func (this *Config) Validate() (err error) {
+	if len(this.Groups) > 0 {
+		err = this.validateGroups()
+		if err != nil {
+			return
+		}
+	}
+
+	if this.Clients < MIN_LOAD {
+		return errors.New("clients must be at least 1")
+	}
+
+	if this.Duration < 0 || this.Warmup < 0 || this.Cooldown < 0 {
+		return errors.New("duration, warmup and cooldown can't be negative")
+	}
+
+	if this.Ops < 0 || this.ClientOps < 0 || this.ReinitAfter < 0 || this.MaxErrors < 0 {
+		return errors.New("ops, client-ops, reinit-after and max-errors can't be negative")
+	}
+
+	if this.OpTimeout < 0 || this.Pace < 0 || this.Rate < 0 || this.ExpectedInterval < 0 {
+		return errors.New("op-timeout, pace, rate and expected-interval can't be negative")
+	}
+
+	if this.ExpectedInterval > 0 {
+		this.CorrectOmission = true
+	}
+
+	this.profile = nil
+	if this.Profile != "" {
+		// A load profile decides the length of the run.
+		this.profile, err = parseProfile(this.Profile, this.Clients)
+		if err != nil {
+			return
+		}
+
+		this.Duration = this.profile.duration()
+	}
+
+	switch {
+	case this.Duration > 0:
+	case this.IsCounted():
+		// Run until the operation budget has been spent.  There's
+		// no end of the measured phase for a cooldown to follow.
+		if this.Cooldown > 0 {
+			return errors.New("a cooldown needs a duration or a load profile, not just an operation count")
+		}
+
+		this.Duration = UNLIMITED_RUN_TIME
+	default:
+		return errors.New("a run needs a duration, an operation count or a load profile")
+	}
+
+	if this.MaxErrorRate < 0 || this.MaxErrorRate > 1 {
+		return errors.New("max-error-rate must be between 0 and 1")
+	}
+
+	switch this.OnTimeout {
+	case "":
+		this.OnTimeout = TIMEOUT_REINIT
+	case TIMEOUT_REINIT, TIMEOUT_ABANDON:
+	default:
+		return errors.New("on-timeout must be one of reinit, abandon")
+	}
+
+	this.think = nil
+	if this.Think != "" {
+		this.think, err = parseThinkTime(this.Think)
+		if err != nil {
+			return
+		}
+	}
+
+	switch {
+	case this.think != nil && this.Pace > 0:
+		return errors.New("think and pace can't be used together")
+	case (this.think != nil || this.Pace > 0) && this.IsOpenLoop():
+		return errors.New("think and pace only apply to closed-loop runs")
+	case this.CorrectOmission && this.IsOpenLoop():
+		return errors.New("coordinated-omission correction only applies to closed-loop runs")
+	}
+
+	switch {
+	case this.HistogramPrecision == 0:
+		this.HistogramPrecision = DEFAULT_HISTOGRAM_PRECISION
+	case this.HistogramPrecision < MIN_HISTOGRAM_PRECISION || this.HistogramPrecision > MAX_HISTOGRAM_PRECISION:
+		return errors.New("histogram precision must be between 1 and 5")
+	}
+
+	switch {
+	case this.SummaryPercentile == 0:
+		this.SummaryPercentile = DEFAULT_SUMMARY_PERCENTILE
+	case this.SummaryPercentile < 0 || this.SummaryPercentile > 100:
+		return errors.New("summary percentile must be between 0 and 100")
+	}
+
+	if this.Seed == 0 {
+		this.Seed = time.Now().UnixNano()
+	}
+
+	switch this.Arrival {
+	case "":
+		this.Arrival = ARRIVAL_FIXED
+	case ARRIVAL_FIXED, ARRIVAL_POISSON:
+	default:
+		return errors.New("arrival must be one of fixed, poisson")
+	}
+
+	if this.IsOpenLoop() {
+		if _, err = parseArrivalQueueSize(this.Properties); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (this *Config) validateGroups() (err error) {
+	if this.Profile != "" {
+		return errors.New("groups and a load profile can't be used together")
+	}
+
+	names := make(map[string]bool)
+	total := 0
+
+	for _, g := range this.Groups {
+		switch {
+		case g.Name == "":
+			return errors.New("every group needs a name")
+		case names[g.Name]:
+			return fmt.Errorf("group %q is named twice", g.Name)
+		case g.Clients < MIN_LOAD:
+			return fmt.Errorf("group %q needs at least 1 client", g.Name)
+		}
+
+		names[g.Name] = true
+		total += g.Clients
+	}
+
+	this.Clients = total
+	return
+}
+
+// The group which the client belongs to, or nil if the run doesn't
+// have any.
+func (this *Config) groupOf(clientId int) *Group {
+	for _, g := range this.Groups {
+		if clientId < g.Clients {
+			return g
+		}
+
+		clientId -= g.Clients
+	}
+
+	return nil
+}
+
+// The properties of a client, which depend on its group.
+func (this *Config) propertiesOf(clientId int) map[string]string {
+	return this.groupProperties(this.groupOf(clientId))
+}
+
+// The run's properties, with a group's added to them.
+func (this *Config) groupProperties(g *Group) map[string]string {
+	if g == nil || len(g.Properties) == 0 {
+		return this.Properties
+	}
+
+	props := make(map[string]string)
+	for k, v := range this.Properties {
+		props[k] = v
+	}
+
+	for k, v := range g.Properties {
+		props[k] = v
+	}
+
+	return props
+}
+
+// Whether operations are issued on a schedule rather than
+// back-to-back by each client.
+func (this *Config) IsOpenLoop() bool {
+	return this.Rate > 0
+}
+
+// Whether the run stops after a number of operations.
+func (this *Config) IsCounted() bool {
+	return this.Ops > 0 || this.ClientOps > 0
+}
+
+// The most clients the run will have at any one time.
+func (this *Config) MaxClients() int {
+	if this.profile != nil {
+		return this.profile.maxClients()
+	}
+
+	return this.Clients
+}
+
+// The total wall-clock time of the run, including the warmup and
+// cooldown phases.
+func (this *Config) RunTime() time.Duration {
+	return this.Warmup + this.Duration + this.Cooldown
+}
@@ -174,6 +174,7 @@ Every 2 seconds,
     -- throughput vs latency (XR curve) (PUNTED)
           -- Nope. This only makes sense if you've got multiple rounds.
              We've only got 1 round currently.
+          -- Now we've got --sweep, which runs 1 round per load level.
 
   - finalize summary output (ACTUAL=20 MIN)
     -- fix bug where the last second/final numbers aren't displayed (FIXED=5 min)
@@ -188,4 +189,10 @@ Every 2 seconds,
     - also the 5th, 95th, and 99th percentiles
     - report these values on os.Stderr as well.
 */
-package main
+
+// Package knock measures the throughput and response time of an
+// arbitrary function (typically, a network request).  A Behavior
+// performs one unit of work, and Run drives a number of them
+// concurrently, returning the statistics it gathered along the way.
+// The knock command in cmd/knock is a thin CLI over this package.
+package knock
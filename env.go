@@ -0,0 +1,94 @@
+package knock
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+)
+
+// What a behavior knows about the client running it.  A ContextBehavior
+// finds it with EnvOf on any context it's given; a Behavior gets it by
+// implementing EnvBehavior.
+type Env struct {
+	// This client's id, from 0 up to (but not including) Clients.
+	ClientId int
+
+	// The number of clients in the run, or the most there will be
+	// at any one time when following a load profile.
+	Clients int
+
+	// Seeded from the run's seed and the client id, so that a run
+	// with the same seed draws the same numbers.  Only this client
+	// may use it; a behavior re-initialized after a timeout or too
+	// many errors gets an Env, and a Rand, of its own.
+	Rand *rand.Rand
+
+	// Writes to the standard error, prefixed with the client id.
+	Log *log.Logger
+
+	// Shared by every client in the run.
+	Shared *SharedState
+
+	// Records the behavior's own counters, gauges and histograms.
+	Metrics Metrics
+
+	// The value returned by the run's Fixture, if it has one.
+	Fixture interface{}
+}
+
+// A Behavior which wants to know about its client.  InitEnv is called
+// instead of Init.
+type EnvBehavior interface {
+	Behavior
+
+	InitEnv(env *Env, props map[string]string) (err error)
+}
+
+type envKey struct{}
+
+func withEnv(ctx context.Context, env *Env) context.Context {
+	return context.WithValue(ctx, envKey{}, env)
+}
+
+// The environment of the client running the behavior, or nil.
+func EnvOf(ctx context.Context) (env *Env) {
+	env, _ = ctx.Value(envKey{}).(*Env)
+	return
+}
+
+// State shared by every client in a run, which is safe for concurrent
+// use, e.g. to hand out ranges of keys.
+type SharedState struct {
+	m sync.Map
+}
+
+func NewSharedState() *SharedState {
+	return &SharedState{}
+}
+
+func (this *SharedState) Load(key string) (value interface{}, ok bool) {
+	return this.m.Load(key)
+}
+
+func (this *SharedState) Store(key string, value interface{}) {
+	this.m.Store(key, value)
+}
+
+// Returns the existing value for the key if there is one, and
+// otherwise stores and returns the given value.
+func (this *SharedState) LoadOrStore(key string, value interface{}) (actual interface{}, loaded bool) {
+	return this.m.LoadOrStore(key, value)
+}
+
+func (this *SharedState) Delete(key string) {
+	this.m.Delete(key)
+}
+
+// Adds to a counter, which starts at zero, and returns its new value.
+// A key used as a counter mustn't be used for anything else.
+func (this *SharedState) Add(key string, delta int64) int64 {
+	v, _ := this.m.LoadOrStore(key, new(int64))
+	return atomic.AddInt64(v.(*int64), delta)
+}
@@ -0,0 +1,300 @@
+package knock
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSharedStateAdd(t *testing.T) {
+	s := NewSharedState()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				s.Add("keys", 1)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if s.Add("keys", 0) != 8000 {
+		t.Errorf("expected: 8000, got: %d", s.Add("keys", 0))
+		return
+	}
+
+	if _, loaded := s.LoadOrStore("name", "a"); loaded {
+		t.Error("expected the value to be stored")
+		return
+	}
+
+	if v, loaded := s.LoadOrStore("name", "b"); !loaded || v != "a" {
+		t.Errorf("expected the existing value, got: %v", v)
+		return
+	}
+}
+
+// Remembers the environment it was given, and the first number it drew.
+type env_behavior struct {
+	dummy_behavior
+	env   *Env
+	first int64
+}
+
+func (this *env_behavior) InitEnv(env *Env, props map[string]string) (err error) {
+	this.env = env
+	this.first = env.Rand.Int63()
+	env.Shared.Add("inits", 1)
+	return
+}
+
+func TestRunPassesEnvToBehaviors(t *testing.T) {
+	var mu sync.Mutex
+	behaviors := []*env_behavior{}
+
+	conf := Config{Clients: 3, Duration: 100 * time.Millisecond, Seed: 42}
+
+	_, err := Run(context.Background(), conf, func() Behavior {
+		mu.Lock()
+		defer mu.Unlock()
+
+		b := &env_behavior{}
+		behaviors = append(behaviors, b)
+		return b
+	})
+
+	if !expectOk(t, err) {
+		return
+	}
+
+	if !expectInt(t, 3, len(behaviors)) {
+		return
+	}
+
+	seen := map[int]bool{}
+	for _, b := range behaviors {
+		if b.env == nil {
+			t.Error("expected InitEnv to be called")
+			return
+		}
+
+		if !expectInt(t, 3, b.env.Clients) {
+			return
+		}
+
+		seen[b.env.ClientId] = true
+
+		want := rand.New(rand.NewSource(42 + int64(b.env.ClientId))).Int63()
+		if b.first != want {
+			t.Errorf("client %d: expected a seeded random source", b.env.ClientId)
+			return
+		}
+
+		if b.env.Shared != behaviors[0].env.Shared {
+			t.Error("expected every client to share state")
+			return
+		}
+	}
+
+	if !expectInt(t, 3, len(seen)) {
+		return
+	}
+
+	if n := behaviors[0].env.Shared.Add("inits", 0); n != 3 {
+		t.Errorf("expected 3 inits, got: %d", n)
+		return
+	}
+}
+
+// Keeps drawing from its client's Rand once its operation has been
+// cancelled, like a behavior which ignores its timeout.
+type rand_behavior struct {
+	env   *Env
+	first int64
+}
+
+func (this *rand_behavior) Init(ctx context.Context, props map[string]string) (err error) {
+	this.env = EnvOf(ctx)
+	this.first = this.env.Rand.Int63()
+	return
+}
+
+func (*rand_behavior) Close(ctx context.Context) {}
+
+func (this *rand_behavior) Work(ctx context.Context) (res OpResult) {
+	<-ctx.Done()
+
+	for i := 0; i < 1000; i += 1 {
+		this.env.Rand.Int63()
+	}
+
+	return OpResult{Status: WRK_ERROR}
+}
+
+func TestSandboxGivesReinitializedBehaviorsTheirOwnEnv(t *testing.T) {
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+
+	tm := NewTaskMaster(&TaskMasterInfo{
+		WaitGroup: wg,
+	})
+	tm.Start()
+
+	rec := NewRecorder(1, DEFAULT_HISTOGRAM_PRECISION)
+	behaviors := []*rand_behavior{}
+
+	sb := NewSandbox(&SandboxInfo{
+		Id:         1,
+		Seed:       42,
+		Properties: make(map[string]string),
+		Duration:   200 * time.Millisecond,
+		StartTime:  time.Now(),
+		Emitter:    rec,
+		WaitGroup:  wg,
+		OpTimeout:  10 * time.Millisecond,
+		OnTimeout:  TIMEOUT_REINIT,
+		Factory: func() ContextBehavior {
+			b := &rand_behavior{}
+			behaviors = append(behaviors, b)
+			return b
+		},
+	})
+
+	sb.Start()
+
+	countResults(tm, rec)
+
+	if len(behaviors) < 2 {
+		t.Errorf("expected the behavior to be re-initialized, got: %d behaviors", len(behaviors))
+		return
+	}
+
+	// The first behavior draws the same numbers as ever.
+	if behaviors[0].first != rand.New(rand.NewSource(43)).Int63() {
+		t.Error("expected the first behavior to be seeded from the seed and the client id")
+		return
+	}
+
+	for i, b := range behaviors[1:] {
+		prev := behaviors[i]
+
+		if b.env == prev.env || b.env.Rand == prev.env.Rand || b.first == prev.first {
+			t.Errorf("expected behavior %d to have an Env of its own", i+1)
+			return
+		}
+
+		if b.env.Shared != prev.env.Shared {
+			t.Error("expected the behaviors to share state")
+			return
+		}
+	}
+}
+
+// Records a metric of each kind on every operation.
+type metrics_behavior struct {
+	dummy_behavior
+	env *Env
+	n   int64
+}
+
+func (this *metrics_behavior) InitEnv(env *Env, props map[string]string) (err error) {
+	this.env = env
+	return
+}
+
+func (this *metrics_behavior) Work(t0 time.Time) (res WorkResult) {
+	this.n += 1
+	this.env.Metrics.Count("retries", 2)
+	this.env.Metrics.Gauge("pool", 4)
+	this.env.Metrics.Observe("matched", this.n%10)
+	return WRK_OK
+}
+
+func TestRunAggregatesBehaviorMetrics(t *testing.T) {
+	conf := Config{Clients: 2, ClientOps: 100}
+
+	res, err := Run(context.Background(), conf, func() Behavior {
+		return &metrics_behavior{}
+	})
+
+	if !expectOk(t, err) {
+		return
+	}
+
+	metrics := res.Metrics()
+	if !expectInt(t, 3, len(metrics)) {
+		return
+	}
+
+	matched, pool, retries := metrics[0], metrics[1], metrics[2]
+
+	if !expectString(t, METRIC_HISTOGRAM, matched.Kind) || !expectInt(t, 200, int(matched.Count)) {
+		return
+	}
+
+	if matched.Histogram.Min != 0 || matched.Histogram.Max != 9 || matched.Mean != 4.5 {
+		t.Errorf("expected values from 0 to 9 with a mean of 4.5, got: %d to %d with a mean of %f",
+			matched.Histogram.Min, matched.Histogram.Max, matched.Mean)
+		return
+	}
+
+	if !expectString(t, METRIC_GAUGE, pool.Kind) {
+		return
+	}
+
+	if pool.Value != 8 {
+		t.Errorf("expected the gauge to be summed across the clients, got: %f", pool.Value)
+		return
+	}
+
+	if !expectString(t, METRIC_COUNTER, retries.Kind) || !expectInt(t, 400, int(retries.Count)) {
+		return
+	}
+}
+
+func TestMetricTotalsForgetRetiredClients(t *testing.T) {
+	totals := newMetricTotals()
+	recs := []*recorder{
+		NewRecorder(0, DEFAULT_HISTOGRAM_PRECISION),
+		NewRecorder(1, DEFAULT_HISTOGRAM_PRECISION),
+	}
+
+	collect := func() float64 {
+		for _, rec := range recs {
+			totals.merge(rec.id, rec.swap(newShard(DEFAULT_HISTOGRAM_PRECISION)))
+		}
+
+		totals.sample()
+		return totals.samples["pool"].last
+	}
+
+	recs[0].Gauge("pool", 4)
+	recs[1].Gauge("pool", 4)
+
+	if v := collect(); v != 8 {
+		t.Errorf("expected the gauge to be summed across the clients, got: %f", v)
+		return
+	}
+
+	recs[1].releaseGauges()
+
+	if v := collect(); v != 4 {
+		t.Errorf("expected the retired client's gauge to be forgotten, got: %f", v)
+		return
+	}
+
+	// A client which comes back sets its gauges afresh.
+	recs[1].releaseGauges()
+	recs[1].Gauge("pool", 2)
+
+	if v := collect(); v != 6 {
+		t.Errorf("expected the new client's gauge to count, got: %f", v)
+		return
+	}
+}
@@ -0,0 +1,95 @@
+package knock
+
+import (
+	"fmt"
+)
+
+// Prepares for a run, and cleans up after it, once for the whole run
+// rather than once per client, e.g. to load a dataset, create indexes
+// or drop a database.
+type Fixture interface {
+	// Called before any client starts.  The value is handed to every
+	// client, in Env.Fixture.  An error stops the run before it
+	// begins.
+	Setup(props map[string]string) (value interface{}, err error)
+
+	// Called once every client has closed its behavior, however the
+	// run ended.
+	Teardown(props map[string]string) (err error)
+}
+
+// A fixture which has been set up, and the properties it was given.
+type fixtureSetup struct {
+	name    string
+	fixture Fixture
+	props   map[string]string
+}
+
+// Sets up the run's fixture or, if the run has groups, the fixture of
+// each group's behavior, with the group's properties.  If one fails,
+// those already set up are torn down again.  Otherwise, the function
+// returned tears them all down, in reverse order.
+func (this *Config) setupFixtures() (teardown func() error, err error) {
+	done := []*fixtureSetup{}
+
+	teardown = func() (err error) {
+		for i := len(done) - 1; i >= 0; i-- {
+			s := done[i]
+			if e := s.fixture.Teardown(s.props); e != nil && err == nil {
+				err = fmt.Errorf("%sfixture teardown failed: %v", s.name, e)
+			}
+		}
+
+		return
+	}
+
+	if len(this.Groups) == 0 {
+		if this.Fixture == nil {
+			return
+		}
+
+		this.fixtureValue, err = this.Fixture.Setup(this.Properties)
+		if err != nil {
+			return nil, fmt.Errorf("fixture setup failed: %v", err)
+		}
+
+		done = append(done, &fixtureSetup{"", this.Fixture, this.Properties})
+		return
+	}
+
+	this.groupFixtures = make(map[*Group]interface{})
+
+	for _, g := range this.Groups {
+		f := this.Fixture
+		if g.Factory != nil {
+			f = g.Fixture
+		}
+
+		if f == nil {
+			continue
+		}
+
+		props := this.groupProperties(g)
+		name := fmt.Sprintf("group %s: ", g.Name)
+
+		this.groupFixtures[g], err = f.Setup(props)
+		if err != nil {
+			teardown()
+			return nil, fmt.Errorf("%sfixture setup failed: %v", name, err)
+		}
+
+		done = append(done, &fixtureSetup{name, f, props})
+	}
+
+	return
+}
+
+// The value which a client's fixture set up, which depends on its
+// group.
+func (this *Config) fixtureOf(clientId int) interface{} {
+	if g := this.groupOf(clientId); g != nil {
+		return this.groupFixtures[g]
+	}
+
+	return this.fixtureValue
+}
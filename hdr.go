@@ -0,0 +1,296 @@
+package knock
+
+import (
+	"math"
+	"math/bits"
+)
+
+const (
+	// The number of significant decimal digits which a histogram
+	// keeps, unless it's told otherwise.
+	DEFAULT_HISTOGRAM_PRECISION = 3
+
+	MIN_HISTOGRAM_PRECISION = 1
+	MAX_HISTOGRAM_PRECISION = 5
+)
+
+// A log-linear (HDR-style) histogram of non-negative values.  Values
+// are exact up to 2*10^precision, and beyond that, each power of two
+// is split into the same number of equal buckets, so that a value is
+// never off by more than one part in 10^precision.  Memory grows with
+// the magnitude of the largest value, not with the number of distinct
+// ones, and histograms of the same precision can be merged.
+//
+// A histogram isn't safe for concurrent use.
+type Histogram struct {
+	precision int
+
+	// The number of exact buckets is 1<<sub_bits; each power of two
+	// after that gets half as many.
+	sub_bits uint
+
+	counts []int64
+	total  int64
+	sum    float64
+	sum_sq float64
+	min    int64
+	max    int64
+}
+
+func NewHistogram(precision int) *Histogram {
+	switch {
+	case precision < MIN_HISTOGRAM_PRECISION:
+		precision = MIN_HISTOGRAM_PRECISION
+	case precision > MAX_HISTOGRAM_PRECISION:
+		precision = MAX_HISTOGRAM_PRECISION
+	}
+
+	sub := uint64(2 * math.Pow10(precision))
+
+	return &Histogram{
+		precision: precision,
+		sub_bits:  uint(bits.Len64(sub - 1)),
+	}
+}
+
+func (this *Histogram) Precision() int {
+	return this.precision
+}
+
+// The bucket which holds a value.
+func (this *Histogram) index(v int64) int {
+	s := int64(1) << this.sub_bits
+	if v < s {
+		return int(v)
+	}
+
+	k := uint(bits.Len64(uint64(v))) - this.sub_bits
+	return int(s + int64(k-1)*(s/2) + (v >> k) - s/2)
+}
+
+// The lowest value which a bucket holds, and how many values it
+// holds.
+func (this *Histogram) bucket(i int) (lo, width int64) {
+	s := 1 << this.sub_bits
+	if i < s {
+		return int64(i), 1
+	}
+
+	j := i - s
+	k := uint(j/(s/2)) + 1
+	sub := int64(j%(s/2) + s/2)
+	return sub << k, 1 << k
+}
+
+// Records a value; negative ones are recorded as zero.
+func (this *Histogram) Record(v int64) {
+	this.RecordN(v, 1)
+}
+
+// Records a value n times.
+func (this *Histogram) RecordN(v int64, n int64) {
+	if v < 0 {
+		v = 0
+	}
+
+	i := this.index(v)
+	this.grow(i + 1)
+	this.counts[i] += n
+
+	if this.total == 0 || v < this.min {
+		this.min = v
+	}
+
+	if v > this.max {
+		this.max = v
+	}
+
+	this.total += n
+	this.sum += float64(v) * float64(n)
+	this.sum_sq += float64(v) * float64(v) * float64(n)
+}
+
+func (this *Histogram) grow(n int) {
+	if n > len(this.counts) {
+		this.counts = append(this.counts, make([]int64, n-len(this.counts))...)
+	}
+}
+
+// Adds another histogram, of the same precision, to this one.
+func (this *Histogram) Merge(o *Histogram) {
+	if o.total == 0 {
+		return
+	}
+
+	this.grow(len(o.counts))
+	for i, n := range o.counts {
+		this.counts[i] += n
+	}
+
+	if this.total == 0 || o.min < this.min {
+		this.min = o.min
+	}
+
+	if o.max > this.max {
+		this.max = o.max
+	}
+
+	this.total += o.total
+	this.sum += o.sum
+	this.sum_sq += o.sum_sq
+}
+
+// Empties the histogram, keeping its buckets for reuse.
+func (this *Histogram) Reset() {
+	for i := range this.counts {
+		this.counts[i] = 0
+	}
+
+	this.total = 0
+	this.sum = 0
+	this.sum_sq = 0
+	this.min = 0
+	this.max = 0
+}
+
+// A snapshot of the histogram, which doesn't change along with it.
+func (this *Histogram) Copy() *Histogram {
+	c := *this
+	c.counts = append([]int64(nil), this.counts...)
+	return &c
+}
+
+// A copy of the histogram, corrected for coordinated omission.  A
+// closed-loop client which waits out a stall doesn't issue the
+// operations it would have every interval in the meantime, so they
+// never get measured.  For each value v, the correction adds the
+// values those operations would have seen, v-interval, v-2*interval
+// and so on, down to the interval itself.
+func (this *Histogram) Corrected(interval int64) (c *Histogram) {
+	c = this.Copy()
+	if interval <= 0 {
+		return
+	}
+
+	for i, n := range this.counts {
+		if n == 0 {
+			continue
+		}
+
+		lo, _ := this.bucket(i)
+
+		// Every missing value in the same bucket is recorded at once,
+		// so that a long stall with a short interval stays cheap.
+		for v := lo - interval; v >= interval; {
+			blo, _ := c.bucket(c.index(v))
+			if blo < interval {
+				blo = interval
+			}
+
+			k := (v-blo)/interval + 1
+			c.RecordN(v, k*n)
+			v -= k * interval
+		}
+	}
+
+	return
+}
+
+func (this *Histogram) Count() int64 {
+	return this.total
+}
+
+func (this *Histogram) Min() int64 {
+	return this.min
+}
+
+func (this *Histogram) Max() int64 {
+	return this.max
+}
+
+func (this *Histogram) Mean() float64 {
+	if this.total == 0 {
+		return 0
+	}
+
+	return this.sum / float64(this.total)
+}
+
+// The (population) standard deviation of the values.  Like the mean,
+// it's computed from the values themselves, not from the buckets.
+func (this *Histogram) StdDev() float64 {
+	if this.total == 0 {
+		return 0
+	}
+
+	mean := this.Mean()
+	variance := this.sum_sq/float64(this.total) - mean*mean
+	if variance < 0 {
+		// Rounding error, when the values are all the same.
+		return 0
+	}
+
+	return math.Sqrt(variance)
+}
+
+// The value below which the given percentage (0-100) of the values
+// fall, e.g. 50 for the median, or 99.99.  Within the histogram's
+// precision, that's the highest value in the bucket which reaches the
+// percentage.
+func (this *Histogram) Percentile(p float64) int64 {
+	if this.total == 0 {
+		return 0
+	}
+
+	if p <= 0 {
+		return this.min
+	}
+
+	rank := int64(math.Ceil(p / 100 * float64(this.total)))
+	if rank > this.total {
+		rank = this.total
+	}
+
+	cum := int64(0)
+	for i, n := range this.counts {
+		cum += n
+		if cum < rank {
+			continue
+		}
+
+		lo, width := this.bucket(i)
+		v := lo + width - 1
+
+		switch {
+		case v > this.max:
+			return this.max
+		case v < this.min:
+			return this.min
+		default:
+			return v
+		}
+	}
+
+	return this.max
+}
+
+// Calls f with the lowest value of each bucket which isn't empty, and
+// its count, from the lowest value up.
+func (this *Histogram) ForEach(f func(value, count int64)) {
+	for i, n := range this.counts {
+		if n > 0 {
+			lo, _ := this.bucket(i)
+			f(lo, n)
+		}
+	}
+}
+
+// The count of the bucket which holds a value.
+func (this *Histogram) countAt(v int64) int64 {
+	i := this.index(v)
+	if i >= len(this.counts) {
+		return 0
+	}
+
+	return this.counts[i]
+}
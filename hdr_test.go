@@ -0,0 +1,189 @@
+package knock
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestHistogramIsExactForSmallValues(t *testing.T) {
+	h := NewHistogram(3)
+
+	for v := int64(0); v < 2000; v++ {
+		h.Record(v)
+	}
+
+	for _, v := range []int64{0, 1, 999, 1999} {
+		if !expectInt(t, 1, int(h.countAt(v))) {
+			return
+		}
+	}
+
+	if !expectInt(t, 999, int(h.Percentile(50))) {
+		return
+	}
+
+	if h.Min() != 0 || h.Max() != 1999 {
+		t.Errorf("expected values from 0 to 1999, got: %d to %d", h.Min(), h.Max())
+		return
+	}
+}
+
+func TestHistogramPrecision(t *testing.T) {
+	for precision := MIN_HISTOGRAM_PRECISION; precision <= MAX_HISTOGRAM_PRECISION; precision++ {
+		h := NewHistogram(precision)
+
+		// Beyond the exact buckets, none is wider than one part in
+		// 10^precision of the values it holds.
+		for _, v := range []int64{12345, 987654321, 1 << 40} {
+			lo, width := h.bucket(h.index(v))
+			if v < lo || v >= lo+width {
+				t.Errorf("precision %d: %d isn't in its bucket [%d, %d)", precision, v, lo, lo+width)
+				return
+			}
+
+			if width > 1 && float64(width) > float64(v)/pow10(precision) {
+				t.Errorf("precision %d: the bucket of %d is %d wide", precision, v, width)
+				return
+			}
+		}
+	}
+}
+
+func pow10(n int) float64 {
+	v := float64(1)
+	for i := 0; i < n; i++ {
+		v *= 10
+	}
+
+	return v
+}
+
+func TestHistogramPercentiles(t *testing.T) {
+	h := NewHistogram(3)
+
+	for v := int64(1); v <= 1000000; v++ {
+		h.Record(v)
+	}
+
+	for _, p := range []float64{50, 99, 99.9, 99.99, 100} {
+		want := p / 100 * 1000000
+		got := float64(h.Percentile(p))
+
+		if got < want || got > want*1.001 {
+			t.Errorf("p%v: expected about %.0f, got: %.0f", p, want, got)
+			return
+		}
+	}
+
+	// A million distinct values fit in a few thousand buckets.
+	if len(h.counts) > 20000 {
+		t.Errorf("expected bounded memory, got %d buckets", len(h.counts))
+		return
+	}
+}
+
+func TestHistogramMerge(t *testing.T) {
+	a, b, all := NewHistogram(2), NewHistogram(2), NewHistogram(2)
+	rng := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 10000; i++ {
+		v := rng.Int63n(1000000)
+		all.Record(v)
+
+		if i%2 == 0 {
+			a.Record(v)
+		} else {
+			b.Record(v)
+		}
+	}
+
+	snapshot := a.Copy()
+	snapshot.Merge(b)
+
+	for _, p := range []float64{0, 5, 50, 95, 99.9, 100} {
+		if snapshot.Percentile(p) != all.Percentile(p) {
+			t.Errorf("p%v: expected %d, got: %d", p, all.Percentile(p), snapshot.Percentile(p))
+			return
+		}
+	}
+
+	if !expectInt(t, 5000, int(a.Count())) {
+		return
+	}
+
+	a.Reset()
+	if a.Count() != 0 || a.Percentile(50) != 0 {
+		t.Error("expected an empty histogram after a reset")
+		return
+	}
+}
+
+func TestHistogramResultFindsEveryPercentile(t *testing.T) {
+	h := NewHistogram(3)
+	h.RecordN(7, 100)
+
+	res := histogram(h, 1)
+
+	// All three percentiles fall in the same bucket.
+	if res.P5 != 7 || res.P95 != 7 || res.P99 != 7 || res.Percentile(99.99) != 7 {
+		t.Errorf("expected every percentile to be 7, got: %d, %d, %d", res.P5, res.P95, res.P99)
+		return
+	}
+
+	if !expectInt(t, 1, len(res.Rows)) {
+		return
+	}
+}
+
+func TestHistogramStdDev(t *testing.T) {
+	h := NewHistogram(3)
+
+	for _, v := range []int64{2, 4, 4, 4, 5, 5, 7, 9} {
+		h.Record(v)
+	}
+
+	if h.Mean() != 5 || h.StdDev() != 2 {
+		t.Errorf("expected a mean of 5 and a standard deviation of 2, got: %f and %f", h.Mean(), h.StdDev())
+		return
+	}
+
+	res := histogram(h, 1)
+	if res.Median != 4 || res.CV != 0.4 {
+		t.Errorf("expected a median of 4 and a CV of 0.4, got: %d and %f", res.Median, res.CV)
+		return
+	}
+}
+
+func TestHistogramCorrectedForCoordinatedOmission(t *testing.T) {
+	h := NewHistogram(3)
+	h.RecordN(10, 99)
+	h.Record(1000)
+
+	c := h.Corrected(10)
+
+	// The stall hid the operations which would have seen 990, 980,
+	// ... and 10.
+	if !expectInt(t, 199, int(c.Count())) {
+		return
+	}
+
+	if h.Percentile(75) != 10 || c.Percentile(75) != 510 {
+		t.Errorf("expected p75 to go from 10 to 510, got: %d and %d", h.Percentile(75), c.Percentile(75))
+		return
+	}
+
+	if !expectInt(t, 100, int(h.Count())) {
+		return
+	}
+
+	// A long stall with a short interval is back-filled a bucket at
+	// a time.
+	h = NewHistogram(3)
+	h.Record(int64(2e9))
+
+	n := h.Corrected(1000).Count()
+	if n < 1998000 || n > 2000000 {
+		t.Errorf("expected about 2000000 values, got: %d", n)
+		return
+	}
+}
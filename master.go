@@ -1,6 +1,8 @@
-package main
+package knock
 
 import (
+	"context"
+	"fmt"
 	"launchpad.net/tomb"
 	_ "log"
 	"sync"
@@ -8,39 +10,77 @@ import (
 )
 
 type SummaryEmitter interface {
-	PublishSummaryEvent(d time.Duration, throughput, responseTime, efficiency float64)
+	PublishSummaryEvent(d time.Duration, throughput float64, responseTime time.Duration, efficiency float64, clients int, reqBandwidth, respBandwidth float64, metrics map[string]float64, percentile float64, percentileResponseTime time.Duration)
+}
+
+// Learns about clients which couldn't get started.
+type FailureEmitter interface {
+	PublishFailure(clientId int, err error)
 }
 
 type SummaryEvent struct {
-	Duration           time.Duration
-	MeanResponseTimeMs float64
-	OpsPerSecond       float64
-	Efficiency         float64
+	Duration         time.Duration
+	Elapsed          time.Duration
+	MeanResponseTime time.Duration
+	OpsPerSecond     float64
+	Efficiency       float64
+	Clients          int
+
+	// Bytes sent and received per second.
+	RequestBytesPerSecond  float64
+	ResponseBytesPerSecond float64
+
+	// The total of each of the behavior's counters, and the latest
+	// sample of each of its gauges.
+	Metrics map[string]float64
+
+	// A percentile (see Config.SummaryPercentile) of the response
+	// times since the previous summary, e.g. a rolling p99.
+	Percentile             float64
+	PercentileResponseTime time.Duration
 }
 
 type master struct {
 	t         tomb.Tomb
-	conf      *AppConfig
+	ctx       context.Context
+	conf      *Config
 	t0        time.Time
 	wg        *sync.WaitGroup
 	tm        *taskmaster
+	sched     *scheduler
+	budget    *opBudget
 	hosts     []*sandbox
+	recorders []*recorder
+	active    int
+	profiling bool
+	stopped   string
+	err       error
+	mu        sync.Mutex
 	stats     *calculator
 	statsChan chan *SummaryEvent
-	factory   BehaviorFactory
+	factory   ContextBehaviorFactory
+	shared    *SharedState
 }
 
-func NewMaster(conf *AppConfig, factory BehaviorFactory) *master {
+func NewMaster(ctx context.Context, conf *Config, factory ContextBehaviorFactory) *master {
 	wg := &sync.WaitGroup{}
 
+	recorders := make([]*recorder, conf.MaxClients())
+	for i := range recorders {
+		recorders[i] = NewRecorder(i, conf.HistogramPrecision)
+	}
+
 	return &master{
+		ctx:       ctx,
 		conf:      conf,
 		wg:        wg,
 		tm:        nil,
-		hosts:     make([]*sandbox, conf.Clients),
+		hosts:     make([]*sandbox, conf.MaxClients()),
+		recorders: recorders,
 		stats:     nil,
 		statsChan: make(chan *SummaryEvent),
 		factory:   factory,
+		shared:    NewSharedState(),
 	}
 }
 
@@ -53,12 +93,41 @@ func (this *master) Stop() (err error) {
 	return this.t.Wait()
 }
 
+// Ends the benchmark early.  The sandboxes finish their current
+// operations and close their behaviors, and the master dies once
+// they have, leaving behind the statistics gathered so far.
+func (this *master) Interrupt() {
+	this.abort("the run was stopped early")
+}
+
+// Ends the benchmark early for the given reason.
+func (this *master) abort(reason string) {
+	this.mu.Lock()
+	if this.stopped == "" {
+		this.stopped = reason
+	}
+	this.mu.Unlock()
+
+	this.stopClients()
+}
+
 func (this *master) SummaryEvents() <-chan *SummaryEvent {
 	return this.statsChan
 }
 
-func (this *master) PublishSummaryEvent(d time.Duration, throughput, responseTime, activeLoad float64) {
-	this.statsChan <- &SummaryEvent{d, responseTime, throughput, activeLoad}
+func (this *master) PublishSummaryEvent(d time.Duration, throughput float64, responseTime time.Duration, activeLoad float64, clients int, reqBandwidth, respBandwidth float64, metrics map[string]float64, percentile float64, percentileResponseTime time.Duration) {
+	this.statsChan <- &SummaryEvent{d, time.Since(this.t0), responseTime, throughput, activeLoad, clients, reqBandwidth, respBandwidth, metrics, percentile, percentileResponseTime}
+}
+
+// Aborts the run when a client's behavior fails to initialize.
+func (this *master) PublishFailure(clientId int, err error) {
+	this.mu.Lock()
+	if this.err == nil {
+		this.err = fmt.Errorf("client %d: behavior failed to initialize: %v", clientId, err)
+	}
+	this.mu.Unlock()
+
+	this.abort("a client failed to initialize")
 }
 
 // Only call this after the goroutine is dead.
@@ -66,10 +135,16 @@ func (this *master) Statistics() Statistics {
 	return this.stats
 }
 
+// Why the run failed, if it did.  Only call this after the goroutine
+// is dead.
+func (this *master) Err() error {
+	return this.err
+}
+
 func (this *master) loop() {
 	const (
 		ProgressInterval = 1 * time.Second
-		MaxChannelReads  = 64
+		ProfileInterval  = 100 * time.Millisecond
 	)
 
 	defer this.t.Done()
@@ -78,6 +153,18 @@ func (this *master) loop() {
 
 	prChan := time.After(ProgressInterval)
 
+	aborted := false
+
+	var lpChan <-chan time.Time
+	if this.conf.profile != nil {
+		lpChan = time.After(ProfileInterval)
+	}
+
+	var budgetChan <-chan struct{}
+	if this.budget != nil {
+		budgetChan = this.budget.Done()
+	}
+
 	for {
 		select {
 		case <-this.t.Dying():
@@ -88,13 +175,28 @@ func (this *master) loop() {
 			this.t.Kill(nil)
 
 		case <-prChan:
+			this.stats.collect()
 			this.stats.summarize()
 			prChan = time.After(ProgressInterval)
 
-		default:
-			// Attempt to read from the channel a bunch of times
-			// between each death check.
-			this.stats.capture(MaxChannelReads)
+			if !aborted {
+				if reason, ok := this.stats.overErrorBudget(); ok {
+					aborted = true
+					this.abort("error budget exceeded: " + reason)
+				}
+			}
+
+		case <-lpChan:
+			if this.adjust() {
+				lpChan = time.After(ProfileInterval)
+			} else {
+				lpChan = nil
+			}
+
+		case <-budgetChan:
+			// Stop the run as soon as the budget has been spent
+			this.stopClients()
+			budgetChan = nil
 		}
 	}
 }
@@ -105,41 +207,178 @@ func (this *master) setup() {
 
 	// Initialize the taskmaster
 	this.tm = NewTaskMaster(&TaskMasterInfo{
-		WaitGroup:  this.wg,
-		Properties: this.conf.Properties,
+		WaitGroup: this.wg,
 	})
 
+	// Initialize the arrival scheduler for open-loop runs
+	if this.conf.IsOpenLoop() {
+		this.sched = NewScheduler(&SchedulerInfo{
+			Rate:       this.conf.Rate,
+			Arrival:    this.conf.Arrival,
+			Duration:   this.conf.RunTime(),
+			StartTime:  this.t0,
+			Properties: this.conf.Properties,
+		})
+	}
+
+	// Initialize the operation budget for counted runs
+	if this.conf.Ops > 0 {
+		this.budget = NewBudget(int64(this.conf.Ops))
+	}
+
 	// Initialize the stats recorder
 	this.stats = NewCalculator(
-		this.conf, this.tm.ResponseTimes(), this, this.t0)
+		this.conf, this.recorders, this, this.sched, this.t0)
 
 	// Initialize client sandboxes
 	count := this.conf.Clients
-	for i := 0; i < count; i += 1 {
-		info := &SandboxInfo{
-			Id:         i,
-			Properties: this.conf.Properties,
-			Duration:   this.conf.d,
-			StartTime:  this.t0,
-			Emitter:    this.tm,
-			WaitGroup:  this.wg,
-			Factory:    this.factory,
-		}
+	if this.conf.profile != nil {
+		count = this.conf.profile.clientsAt(-this.conf.Warmup)
 
-		this.hosts[i] = NewSandbox(info)
+		// Hold the taskmaster open until the run is over, so that
+		// it can't mistake a moment between retiring and spawning
+		// sandboxes for the end of the run.
+		this.profiling = true
 		this.wg.Add(1)
 	}
 
+	for i := 0; i < count; i += 1 {
+		this.hosts[i] = this.newSandbox(i)
+		this.wg.Add(1)
+	}
+
+	this.active = count
+	this.stats.setLoad(count)
+
 	// Spawn the taskmaster
 	this.tm.Start()
 
 	// Spawn each sandbox
-	for _, host := range this.hosts {
+	for _, host := range this.hosts[:count] {
 		host.Start()
 	}
+
+	// Spawn the scheduler
+	if this.sched != nil {
+		this.sched.Start()
+	}
+}
+
+// The behavior of a client, which depends on its group.
+func (this *master) factoryOf(clientId int) ContextBehaviorFactory {
+	if g := this.conf.groupOf(clientId); g != nil && g.Factory != nil {
+		return g.Factory
+	}
+
+	return this.factory
+}
+
+func (this *master) newSandbox(id int) *sandbox {
+	return NewSandbox(&SandboxInfo{
+		Context:     this.ctx,
+		Id:          id,
+		Clients:     this.conf.MaxClients(),
+		Seed:        this.conf.Seed,
+		Shared:      this.shared,
+		Fixture:     this.conf.fixtureOf(id),
+		Properties:  this.conf.propertiesOf(id),
+		Duration:    this.conf.RunTime(),
+		Warmup:      this.conf.Warmup,
+		Cooldown:    this.conf.Cooldown,
+		StartTime:   this.t0,
+		Emitter:     this.recorders[id],
+		Metrics:     this.recorders[id],
+		Supervisor:  this,
+		WaitGroup:   this.wg,
+		Factory:     this.factoryOf(id),
+		Scheduler:   this.sched,
+		Budget:      this.budget,
+		OpsLimit:    this.conf.ClientOps,
+		OpTimeout:   this.conf.OpTimeout,
+		OnTimeout:   this.conf.OnTimeout,
+		ReinitAfter: this.conf.ReinitAfter,
+		Think:       this.conf.think,
+		Pace:        this.conf.Pace,
+	})
+}
+
+// Spawns or retires sandboxes to follow the load profile.  Returns
+// false once the profile no longer needs adjusting.
+func (this *master) adjust() (ok bool) {
+	elapsed := time.Since(this.t0)
+
+	if elapsed >= this.conf.RunTime() {
+		this.release()
+		return
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if !this.profiling {
+		return
+	}
+
+	target := this.conf.profile.clientsAt(elapsed - this.conf.Warmup)
+
+	for this.active < target {
+		host := this.newSandbox(this.active)
+		this.hosts[this.active] = host
+		this.wg.Add(1)
+		host.Start()
+		this.active += 1
+	}
+
+	for this.active > target {
+		this.active -= 1
+		this.hosts[this.active].Release()
+		this.hosts[this.active] = nil
+	}
+
+	this.stats.setLoad(this.active)
+	return true
+}
+
+// Retires every sandbox, and stops scheduling new operations.
+func (this *master) stopClients() {
+	this.mu.Lock()
+	for _, host := range this.hosts {
+		if host != nil {
+			host.Retire()
+		}
+	}
+	this.mu.Unlock()
+
+	this.release()
+
+	if this.sched != nil {
+		this.sched.Stop()
+	}
+}
+
+// Lets the taskmaster finish once the last sandbox does.
+func (this *master) release() {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.profiling {
+		this.profiling = false
+		this.wg.Done()
+	}
 }
 
 func (this *master) shutdown() {
+	this.release()
+	this.stats.collect()
+
+	this.mu.Lock()
+	this.stats.finish(this.stopped)
+	this.mu.Unlock()
+
+	if this.sched != nil {
+		this.sched.Stop()
+	}
+
 	this.stats.summarize()
 	close(this.statsChan)
 }
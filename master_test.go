@@ -1,9 +1,9 @@
-package main
+package knock
 
 import (
+	"context"
 	_ "log"
 	"log"
-	"strconv"
 	"testing"
 	"time"
 )
@@ -17,23 +17,22 @@ func TestMaster(t *testing.T) {
 		t.Skip("skipping test in short mode.")
 	}
 
-	args := []string{
-		"-c", "8",
-		"-d", strconv.Itoa(RunTime),
-		"-v",
-		"-p", "mongodb.url:mongodb://localhost:27017",
-		"-p", "mongodb.run:counters",
+	conf := &Config{
+		Clients:  8,
+		Duration: RunTime * time.Second,
 	}
 
-	conf, err := parseArgs(args)
+	err := conf.Validate()
 	if err != nil {
 		t.Error(err)
 		return
 	}
 
-	log.Printf("Running a %d second test...", conf.Duration)
+	log.Printf("Running a %s test...", conf.Duration)
 
-	m := NewMaster(conf, func() Behavior { return &mongodb_behavior{} })
+	m := NewMaster(context.Background(), conf, Adapt(func() Behavior {
+		return &dummy_behavior{sleep: 1 * time.Millisecond}
+	}))
 	m.Start()
 
 	reportProgress(m)
@@ -58,10 +57,73 @@ func reportProgress(m *master) {
 				break
 			}
 
-			efficiency := u.MeanResponseTimeMs * (u.OpsPerSecond / 1e6) / float64(m.conf.Clients)
+			efficiency := u.MeanResponseTime.Seconds() * u.OpsPerSecond / float64(m.conf.Clients)
 
-			log.Printf("Response Time (usec): %.3f, Throughput (ops/sec): %.3f, Efficiency (%%): %.3f",
-				u.MeanResponseTimeMs, u.OpsPerSecond, efficiency)
+			log.Printf("Response Time: %s, Throughput (ops/sec): %.3f, Efficiency (%%): %.3f",
+				u.MeanResponseTime, u.OpsPerSecond, efficiency)
 		}
 	}
 }
+
+func TestMasterInterrupt(t *testing.T) {
+	conf := &Config{Clients: 4, Duration: 60 * time.Second}
+
+	err := conf.Validate()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	m := NewMaster(context.Background(), conf, Adapt(func() Behavior {
+		return &dummy_behavior{sleep: 1 * time.Millisecond}
+	}))
+	m.Start()
+
+	time.AfterFunc(500*time.Millisecond, m.Interrupt)
+
+	reportProgress(m)
+
+	s := m.Statistics()
+
+	if !expectBool(t, true, s.Interrupted()) {
+		return
+	}
+
+	if s.RunTime() > 5*time.Second {
+		t.Errorf("expected the run to stop early, but it took %s", s.RunTime())
+		return
+	}
+
+	if s.Operations() == 0 {
+		t.Error("expected some operations before the interrupt")
+		return
+	}
+}
+
+func TestMasterAbortsOverErrorBudget(t *testing.T) {
+	conf := &Config{Clients: 2, Duration: 60 * time.Second, MaxErrorRate: 0.25}
+
+	err := conf.Validate()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	m := NewMaster(context.Background(), conf, Adapt(func() Behavior {
+		return &flaky_behavior{failEvery: 2}
+	}))
+	m.Start()
+
+	reportProgress(m)
+
+	s := m.Statistics()
+
+	if !expectBool(t, true, s.Interrupted()) {
+		return
+	}
+
+	if s.RunTime() > 5*time.Second {
+		t.Errorf("expected the run to be aborted, but it took %s", s.RunTime())
+		return
+	}
+}
@@ -0,0 +1,238 @@
+package knock
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	METRIC_COUNTER   = "counter"
+	METRIC_GAUGE     = "gauge"
+	METRIC_HISTOGRAM = "histogram"
+)
+
+// Records what a behavior knows and the harness doesn't, e.g. how
+// many retries it needed, how big the server's reply was, or how many
+// documents matched.  Each client has its own, in its Env.
+//
+// Counts and observations made during the warmup and cooldown phases
+// are ignored, like the operations themselves.
+type Metrics interface {
+	// Adds to a counter.
+	Count(name string, delta int64)
+
+	// Sets a gauge to its current value.
+	Gauge(name string, value float64)
+
+	// Adds a value to a histogram; negative values count as zero.
+	Observe(name string, value int64)
+}
+
+// The totals of a behavior's metric.
+type MetricResult struct {
+	Name string
+	Kind string
+
+	// A counter's total, and its rate per second.
+	Count int64
+	Rate  float64
+
+	// A gauge's last value, summed across the clients, and the mean,
+	// min and max of the values sampled once per progress interval.
+	Value float64
+	Mean  float64
+	Min   float64
+	Max   float64
+
+	// A histogram of the observed values; Mean holds their average,
+	// and Count how many there were.
+	Histogram *HistogramResult
+}
+
+// Passes a behavior's measurements on to its recorder, unless they
+// were made outside of the measured phase.  Gauges are levels rather
+// than amounts, so they always get through.
+type phasedMetrics struct {
+	s    *sandbox
+	sink Metrics
+}
+
+func (this *phasedMetrics) Count(name string, delta int64) {
+	if this.s.measuring(time.Now()) {
+		this.sink.Count(name, delta)
+	}
+}
+
+func (this *phasedMetrics) Gauge(name string, value float64) {
+	this.sink.Gauge(name, value)
+}
+
+func (this *phasedMetrics) Observe(name string, value int64) {
+	if this.s.measuring(time.Now()) {
+		this.sink.Observe(name, value)
+	}
+}
+
+// Forgets the gauges of a retired client, so that they no longer
+// count towards the totals.
+func (this *phasedMetrics) release() {
+	if r, ok := this.sink.(gaugeReleaser); ok {
+		r.releaseGauges()
+	}
+}
+
+// A Metrics which can forget the gauges of a retired client.
+type gaugeReleaser interface {
+	releaseGauges()
+}
+
+// Throws every measurement away.
+type discardMetrics struct{}
+
+func (discardMetrics) Count(name string, delta int64)   {}
+func (discardMetrics) Gauge(name string, value float64) {}
+func (discardMetrics) Observe(name string, value int64) {}
+
+// The samples taken of a gauge, one per progress interval.
+type gaugeSamples struct {
+	last, sum, min, max float64
+	n                   int
+}
+
+func (this *gaugeSamples) add(v float64) {
+	if this.n == 0 || v < this.min {
+		this.min = v
+	}
+
+	if this.n == 0 || v > this.max {
+		this.max = v
+	}
+
+	this.last = v
+	this.sum += v
+	this.n += 1
+}
+
+// Every client's metrics, merged.
+type metricTotals struct {
+	counters map[string]int64
+	values   map[string]*Histogram
+
+	// The last value of each gauge set by each client, and the
+	// samples of their sum.
+	gauges  map[string]map[int]float64
+	samples map[string]*gaugeSamples
+}
+
+func newMetricTotals() metricTotals {
+	return metricTotals{
+		counters: make(map[string]int64),
+		values:   make(map[string]*Histogram),
+		gauges:   make(map[string]map[int]float64),
+		samples:  make(map[string]*gaugeSamples),
+	}
+}
+
+// Merges what a client has recorded since the last time.
+func (this *metricTotals) merge(clientId int, s *shard) {
+	for name, delta := range s.counters {
+		this.counters[name] += delta
+	}
+
+	if s.released {
+		for _, clients := range this.gauges {
+			delete(clients, clientId)
+		}
+	}
+
+	for name, v := range s.gauges {
+		if this.gauges[name] == nil {
+			this.gauges[name] = make(map[int]float64)
+		}
+
+		this.gauges[name][clientId] = v
+	}
+
+	for name, hist := range s.values {
+		if this.values[name] == nil {
+			this.values[name] = NewHistogram(hist.Precision())
+		}
+
+		this.values[name].Merge(hist)
+	}
+}
+
+// Samples every gauge, once per progress interval.
+func (this *metricTotals) sample() {
+	for name, clients := range this.gauges {
+		sum := float64(0)
+		for _, v := range clients {
+			sum += v
+		}
+
+		if this.samples[name] == nil {
+			this.samples[name] = &gaugeSamples{}
+		}
+
+		this.samples[name].add(sum)
+	}
+}
+
+// The total of each counter, and the latest sample of each gauge.
+func (this *metricTotals) snapshot() (res map[string]float64) {
+	res = make(map[string]float64)
+
+	for name, count := range this.counters {
+		res[name] = float64(count)
+	}
+
+	for name, s := range this.samples {
+		res[name] = s.last
+	}
+
+	return
+}
+
+// Every metric, sorted by name, with counter rates over the given
+// measured time.
+func (this *metricTotals) results(d time.Duration) (res []*MetricResult) {
+	for name, count := range this.counters {
+		r := &MetricResult{Name: name, Kind: METRIC_COUNTER, Count: count}
+		if d > 0 {
+			r.Rate = float64(count) / d.Seconds()
+		}
+
+		res = append(res, r)
+	}
+
+	for name, s := range this.samples {
+		res = append(res, &MetricResult{
+			Name:  name,
+			Kind:  METRIC_GAUGE,
+			Value: s.last,
+			Mean:  s.sum / float64(s.n),
+			Min:   s.min,
+			Max:   s.max,
+		})
+	}
+
+	for name, hist := range this.values {
+		res = append(res, &MetricResult{
+			Name:      name,
+			Kind:      METRIC_HISTOGRAM,
+			Count:     hist.Count(),
+			Mean:      hist.Mean(),
+			Histogram: histogram(hist, 1),
+		})
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Name != res[j].Name {
+			return res[i].Name < res[j].Name
+		}
+
+		return res[i].Kind < res[j].Kind
+	})
+
+	return
+}
@@ -0,0 +1,151 @@
+package knock
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Weights are read from properties named after the operations,
+	// e.g. mix.read:95 and mix.update:5.
+	MIX_WEIGHT_PREFIX = "mix."
+)
+
+// Builds a behavior which picks each of its operations from a
+// weighted mix of named behaviors, e.g. 95% reads and 5% updates as
+// in YCSB workload B.  The weights come from the properties (see
+// MIX_WEIGHT_PREFIX), and behaviors without a weight aren't used.
+// Operations are labeled with the name of the behavior which ran
+// them, unless it labeled them itself.
+func Mix(ops map[string]ContextBehaviorFactory) ContextBehaviorFactory {
+	return func() ContextBehavior {
+		return &mixBehavior{ops: ops}
+	}
+}
+
+type mixOp struct {
+	name     string
+	weight   float64
+	behavior ContextBehavior
+}
+
+type mixBehavior struct {
+	ops   map[string]ContextBehaviorFactory
+	mix   []*mixOp
+	total float64
+	rng   *rand.Rand
+}
+
+func (this *mixBehavior) Init(ctx context.Context, props map[string]string) (err error) {
+	err = this.parseWeights(props)
+	if err != nil {
+		return
+	}
+
+	// The client's random numbers keep a seeded run repeatable.
+	if env := EnvOf(ctx); env != nil {
+		this.rng = env.Rand
+	} else {
+		this.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	for _, op := range this.mix {
+		op.behavior = this.ops[op.name]()
+
+		err = op.behavior.Init(ctx, props)
+		if err != nil {
+			op.behavior = nil
+			this.Close(ctx)
+			return fmt.Errorf("%s: %v", op.name, err)
+		}
+	}
+
+	return
+}
+
+func (this *mixBehavior) parseWeights(props map[string]string) (err error) {
+	this.mix = nil
+	this.total = 0
+
+	for k, v := range props {
+		if !strings.HasPrefix(k, MIX_WEIGHT_PREFIX) {
+			continue
+		}
+
+		name := strings.TrimPrefix(k, MIX_WEIGHT_PREFIX)
+		if _, ok := this.ops[name]; !ok {
+			return fmt.Errorf("%s names an unknown operation (expected one of %s)", k, this.names())
+		}
+
+		w, err := strconv.ParseFloat(v, 64)
+		if err != nil || w < 0 {
+			return fmt.Errorf("%s must be a weight >= 0", k)
+		}
+
+		if w > 0 {
+			this.mix = append(this.mix, &mixOp{name: name, weight: w})
+			this.total += w
+		}
+	}
+
+	if this.total == 0 {
+		return fmt.Errorf("a mix needs a %sNAME weight for at least one of %s", MIX_WEIGHT_PREFIX, this.names())
+	}
+
+	// Map iteration is random, which would spoil a seeded run.
+	sort.Slice(this.mix, func(i, j int) bool {
+		return this.mix[i].name < this.mix[j].name
+	})
+
+	return
+}
+
+// The names of the operations, sorted.
+func (this *mixBehavior) names() (names []string) {
+	for name := range this.ops {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return
+}
+
+func (this *mixBehavior) Close(ctx context.Context) {
+	for _, op := range this.mix {
+		if op.behavior != nil {
+			op.behavior.Close(ctx)
+			op.behavior = nil
+		}
+	}
+}
+
+func (this *mixBehavior) Work(ctx context.Context) (res OpResult) {
+	op := this.pick()
+
+	res = op.behavior.Work(ctx)
+	if res.Label == "" {
+		res.Label = op.name
+	}
+
+	return
+}
+
+// Chooses the next operation, in proportion to the weights.
+func (this *mixBehavior) pick() *mixOp {
+	x := this.rng.Float64() * this.total
+
+	for _, op := range this.mix {
+		if x < op.weight {
+			return op
+		}
+
+		x -= op.weight
+	}
+
+	return this.mix[len(this.mix)-1]
+}
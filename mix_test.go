@@ -0,0 +1,92 @@
+package knock
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+)
+
+// Counts its operations, and labels them if asked to.
+type counting_behavior struct {
+	count *int
+	label string
+}
+
+func (*counting_behavior) Init(ctx context.Context, props map[string]string) (err error) {
+	return
+}
+
+func (*counting_behavior) Close(ctx context.Context) {}
+
+func (this *counting_behavior) Work(ctx context.Context) (res OpResult) {
+	*this.count += 1
+	return OpResult{Status: WRK_OK, Label: this.label}
+}
+
+func TestMixPicksByWeight(t *testing.T) {
+	reads, updates, inserts := 0, 0, 0
+
+	factory := Mix(map[string]ContextBehaviorFactory{
+		"read":   func() ContextBehavior { return &counting_behavior{count: &reads} },
+		"update": func() ContextBehavior { return &counting_behavior{count: &updates, label: "upsert"} },
+		"insert": func() ContextBehavior { return &counting_behavior{count: &inserts} },
+	})
+
+	env := &Env{Rand: rand.New(rand.NewSource(42)), Log: log.New(os.Stderr, "", 0)}
+	ctx := withEnv(context.Background(), env)
+
+	props := map[string]string{"mix.read": "95", "mix.update": "5", "mix.insert": "0"}
+
+	b := factory()
+	if !expectOk(t, b.Init(ctx, props)) {
+		return
+	}
+
+	defer b.Close(ctx)
+
+	labels := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		res := b.Work(withIntendedStartTime(ctx, time.Now()))
+		labels[res.Label] += 1
+	}
+
+	if reads < 9300 || reads > 9700 || reads+updates != 10000 {
+		t.Errorf("expected about 9500 reads and 500 updates, got: %d and %d", reads, updates)
+		return
+	}
+
+	if !expectInt(t, 0, inserts) {
+		return
+	}
+
+	// Behaviors which label their own operations keep their labels.
+	if labels["read"] != reads || labels["upsert"] != updates {
+		t.Errorf("expected the operations to be labeled, got: %v", labels)
+		return
+	}
+}
+
+func TestMixRejectsBadWeights(t *testing.T) {
+	n := 0
+	factory := Mix(map[string]ContextBehaviorFactory{
+		"read": func() ContextBehavior { return &counting_behavior{count: &n} },
+	})
+
+	invalid := []map[string]string{
+		{},
+		{"mix.read": "0"},
+		{"mix.read": "-1"},
+		{"mix.read": "lots"},
+		{"mix.read": "1", "mix.write": "1"},
+	}
+
+	for _, props := range invalid {
+		if err := factory().Init(context.Background(), props); err == nil {
+			t.Errorf("expected an error for %v", props)
+			return
+		}
+	}
+}
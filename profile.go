@@ -0,0 +1,206 @@
+package knock
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	STAGE_RAMP  = "ramp"
+	STAGE_STEP  = "step"
+	STAGE_SPIKE = "spike"
+	STAGE_HOLD  = "hold"
+)
+
+// One stage of a load profile.  The number of clients moves from
+// `from` to `to` over the duration of the stage, which only makes
+// a difference for ramps; every other kind of stage is flat.
+type loadStage struct {
+	kind string
+	from int
+	to   int
+	d    time.Duration
+}
+
+// A load profile describes how many clients should be active at
+// each instant of the measured part of a run, e.g.
+//
+//   ramp:1->64 over 60s, hold 120s, spike 256 for 10s
+//
+// Stages run in order.  A ramp moves linearly between two client
+// counts (the first may be omitted to ramp from the current level),
+// a step jumps to a new level for a while, a spike jumps to a new
+// level and then falls back, and a hold keeps the current level.
+type loadProfile struct {
+	spec   string
+	stages []*loadStage
+	final  int
+}
+
+// Parses a load profile.  The initial level is used until a stage
+// says otherwise.
+func parseProfile(spec string, initial int) (this *loadProfile, err error) {
+	this = &loadProfile{spec: spec}
+	level := initial
+
+	for _, s := range strings.Split(spec, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+
+		stage, err := parseStage(s, level)
+		if err != nil {
+			return nil, err
+		}
+
+		if stage.kind != STAGE_SPIKE {
+			level = stage.to
+		}
+
+		this.stages = append(this.stages, stage)
+	}
+
+	if len(this.stages) == 0 {
+		return nil, errors.New("profile must contain at least one stage")
+	}
+
+	this.final = level
+	return
+}
+
+func parseStage(s string, level int) (stage *loadStage, err error) {
+	kind, rest := s, ""
+	if i := strings.IndexAny(s, ": "); i >= 0 {
+		kind, rest = s[:i], s[i+1:]
+	}
+
+	args := strings.Fields(rest)
+	stage = &loadStage{kind: kind, from: level, to: level}
+
+	switch kind {
+	case STAGE_RAMP:
+		// ramp [FROM->]TO over DURATION
+		if len(args) != 3 || args[1] != "over" {
+			return nil, fmt.Errorf("bad stage %q, expected: ramp FROM->TO over DURATION", s)
+		}
+
+		if i := strings.Index(args[0], "->"); i >= 0 {
+			stage.from, err = parseLevel(args[0][:i])
+			if err != nil {
+				return
+			}
+
+			args[0] = args[0][i+2:]
+		}
+
+		stage.to, err = parseLevel(args[0])
+		if err != nil {
+			return
+		}
+
+		stage.d, err = parseStageDuration(args[2])
+
+	case STAGE_STEP, STAGE_SPIKE:
+		// step|spike CLIENTS for DURATION
+		if len(args) != 3 || args[1] != "for" {
+			return nil, fmt.Errorf("bad stage %q, expected: %s CLIENTS for DURATION", s, kind)
+		}
+
+		stage.from, err = parseLevel(args[0])
+		if err != nil {
+			return
+		}
+
+		stage.to = stage.from
+		stage.d, err = parseStageDuration(args[2])
+
+	case STAGE_HOLD:
+		// hold DURATION
+		if len(args) != 1 {
+			return nil, fmt.Errorf("bad stage %q, expected: hold DURATION", s)
+		}
+
+		stage.d, err = parseStageDuration(args[0])
+
+	default:
+		return nil, fmt.Errorf("bad stage %q, must be one of ramp, step, spike, hold", s)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+func parseLevel(s string) (n int, err error) {
+	n, err = strconv.Atoi(s)
+	if err != nil || n < MIN_LOAD {
+		return 0, fmt.Errorf("bad client count %q, must be >= %d", s, MIN_LOAD)
+	}
+
+	return
+}
+
+func parseStageDuration(s string) (d time.Duration, err error) {
+	d, err = time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("bad stage duration %q", s)
+	}
+
+	return
+}
+
+// The combined length of every stage.
+func (this *loadProfile) duration() (d time.Duration) {
+	for _, stage := range this.stages {
+		d += stage.d
+	}
+
+	return
+}
+
+// The largest number of clients the profile will ever ask for.
+func (this *loadProfile) maxClients() (n int) {
+	n = this.final
+
+	for _, stage := range this.stages {
+		if stage.from > n {
+			n = stage.from
+		}
+
+		if stage.to > n {
+			n = stage.to
+		}
+	}
+
+	return
+}
+
+// The number of clients which should be active at the given
+// offset into the profile.
+func (this *loadProfile) clientsAt(t time.Duration) int {
+	if t < 0 {
+		return this.stages[0].from
+	}
+
+	for _, stage := range this.stages {
+		if t < stage.d {
+			delta := float64(stage.to-stage.from) * float64(t) / float64(stage.d)
+			return stage.from + int(math.Floor(delta+0.5))
+		}
+
+		t -= stage.d
+	}
+
+	return this.final
+}
+
+func (this *loadProfile) String() string {
+	return this.spec
+}
@@ -0,0 +1,89 @@
+package knock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseProfile(t *testing.T) {
+	lp, err := parseProfile("ramp:1->64 over 60s, hold 120s, spike 256 for 10s", 1)
+	if !expectOk(t, err) {
+		return
+	}
+
+	if !expectInt(t, 3, len(lp.stages)) {
+		return
+	}
+
+	if lp.duration() != 190*time.Second {
+		t.Errorf("expected: %s, got: %s", 190*time.Second, lp.duration())
+		return
+	}
+
+	if !expectInt(t, 256, lp.maxClients()) {
+		return
+	}
+
+	expectations := []struct {
+		at      time.Duration
+		clients int
+	}{
+		{-5 * time.Second, 1},
+		{0, 1},
+		{30 * time.Second, 33},
+		{60 * time.Second, 64},
+		{179 * time.Second, 64},
+		{180 * time.Second, 256},
+		{190 * time.Second, 64},
+		{1 * time.Hour, 64},
+	}
+
+	for _, e := range expectations {
+		if !expectInt(t, e.clients, lp.clientsAt(e.at)) {
+			t.Errorf("at %s", e.at)
+			return
+		}
+	}
+}
+
+func TestParseProfileStartsFromInitialLevel(t *testing.T) {
+	lp, err := parseProfile("hold 10s, step:8 for 10s, ramp 2 over 10s", 4)
+	if !expectOk(t, err) {
+		return
+	}
+
+	if !expectInt(t, 4, lp.clientsAt(5*time.Second)) {
+		return
+	}
+
+	if !expectInt(t, 8, lp.clientsAt(15*time.Second)) {
+		return
+	}
+
+	if !expectInt(t, 5, lp.clientsAt(25*time.Second)) {
+		return
+	}
+
+	if !expectInt(t, 2, lp.clientsAt(30*time.Second)) {
+		return
+	}
+}
+
+func TestParseBadProfiles(t *testing.T) {
+	specs := []string{
+		"",
+		"hold",
+		"hold forever",
+		"ramp 1->0 over 10s",
+		"ramp 1->8 for 10s",
+		"spike 8",
+		"sprint 8 for 10s",
+	}
+
+	for _, spec := range specs {
+		if _, err := parseProfile(spec, 1); err == nil {
+			t.Errorf("expected an error for profile %q", spec)
+			return
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package knock
+
+import (
+	"sync"
+	"time"
+)
+
+type LatencyEmitter interface {
+	PublishResponseTime(clientId int, latency time.Duration, res OpResult)
+	PublishThinkTime(clientId int, d time.Duration)
+}
+
+// The statistics recorded by one client between two progress
+// intervals.  Times are kept in nanoseconds.
+type shard struct {
+	hist      *Histogram
+	lag_sum   int64
+	ops       int64
+	think_sum int64
+	errors    map[WorkResult]int
+
+	// The response times of the failed operations, by status.
+	failed map[WorkResult]*Histogram
+
+	// Bytes sent and received by every operation, failed or not.
+	req_bytes  int64
+	resp_bytes int64
+
+	// The same again for each labeled type of operation.
+	labels map[string]*shard
+
+	// The behavior's own metrics, if it has any.
+	counters map[string]int64
+	gauges   map[string]float64
+	values   map[string]*Histogram
+
+	// Whether the client has been retired, so that the gauges it set
+	// before this shard no longer count.
+	released bool
+}
+
+func newShard(precision int) *shard {
+	return &shard{
+		hist:   NewHistogram(precision),
+		errors: make(map[WorkResult]int),
+	}
+}
+
+func (this *shard) record(nsec int64, res OpResult) {
+	this.req_bytes += res.RequestBytes
+	this.resp_bytes += res.ResponseBytes
+
+	// Count errors, but don't pollute the ops counter, or the
+	// response times of the operations which succeeded.
+	if res.Status != WRK_OK {
+		this.errors[res.Status] += 1
+		this.failedHist(res.Status).Record(nsec)
+	} else {
+		this.hist.Record(nsec)
+		this.lag_sum += nsec
+		this.ops += 1
+	}
+}
+
+// The shard for a type of operation.
+func (this *shard) label(name string) *shard {
+	if this.labels == nil {
+		this.labels = make(map[string]*shard)
+	}
+
+	s, ok := this.labels[name]
+	if !ok {
+		s = newShard(this.hist.Precision())
+		this.labels[name] = s
+	}
+
+	return s
+}
+
+// The histogram of the response times of the operations which failed
+// with a status.
+func (this *shard) failedHist(status WorkResult) *Histogram {
+	if this.failed == nil {
+		this.failed = make(map[WorkResult]*Histogram)
+	}
+
+	h, ok := this.failed[status]
+	if !ok {
+		h = NewHistogram(this.hist.Precision())
+		this.failed[status] = h
+	}
+
+	return h
+}
+
+// Adds another shard's statistics to this one's.
+func (this *shard) merge(s *shard) {
+	this.hist.Merge(s.hist)
+
+	for res, count := range s.errors {
+		this.errors[res] += count
+	}
+
+	for res, h := range s.failed {
+		this.failedHist(res).Merge(h)
+	}
+
+	this.lag_sum += s.lag_sum
+	this.ops += s.ops
+	this.think_sum += s.think_sum
+	this.req_bytes += s.req_bytes
+	this.resp_bytes += s.resp_bytes
+
+	for name, ls := range s.labels {
+		this.label(name).merge(ls)
+	}
+}
+
+func (this *shard) reset() {
+	this.hist.Reset()
+
+	for k := range this.errors {
+		delete(this.errors, k)
+	}
+
+	for _, h := range this.failed {
+		h.Reset()
+	}
+
+	this.lag_sum = 0
+	this.ops = 0
+	this.think_sum = 0
+	this.req_bytes = 0
+	this.resp_bytes = 0
+
+	// Keep the labels, which are likely to turn up again.
+	for _, s := range this.labels {
+		s.reset()
+	}
+
+	for k := range this.counters {
+		delete(this.counters, k)
+	}
+
+	for k := range this.gauges {
+		delete(this.gauges, k)
+	}
+
+	for k := range this.values {
+		delete(this.values, k)
+	}
+
+	this.released = false
+}
+
+// Each client records its response times into its own recorder,
+// rather than sending them anywhere, so that recording an operation
+// costs no more than an uncontended lock and a map update.  The
+// calculator swaps the recorder's shard out once per progress
+// interval and merges it into the totals.
+type recorder struct {
+	id   int
+	mu   sync.Mutex
+	curr *shard
+}
+
+func NewRecorder(id int, precision int) *recorder {
+	return &recorder{
+		id:   id,
+		curr: newShard(precision),
+	}
+}
+
+func (this *recorder) PublishResponseTime(clientId int, latency time.Duration, res OpResult) {
+	this.mu.Lock()
+
+	this.curr.record(int64(latency), res)
+
+	if res.Label != "" {
+		this.curr.label(res.Label).record(int64(latency), res)
+	}
+
+	this.mu.Unlock()
+}
+
+func (this *recorder) Count(name string, delta int64) {
+	this.mu.Lock()
+
+	if this.curr.counters == nil {
+		this.curr.counters = make(map[string]int64)
+	}
+
+	this.curr.counters[name] += delta
+	this.mu.Unlock()
+}
+
+func (this *recorder) Gauge(name string, value float64) {
+	this.mu.Lock()
+
+	if this.curr.gauges == nil {
+		this.curr.gauges = make(map[string]float64)
+	}
+
+	this.curr.gauges[name] = value
+	this.mu.Unlock()
+}
+
+// Forgets the gauges of a client which has been retired.  Any it sets
+// afterwards count again.
+func (this *recorder) releaseGauges() {
+	this.mu.Lock()
+
+	for k := range this.curr.gauges {
+		delete(this.curr.gauges, k)
+	}
+
+	this.curr.released = true
+	this.mu.Unlock()
+}
+
+func (this *recorder) Observe(name string, value int64) {
+	this.mu.Lock()
+
+	if this.curr.values == nil {
+		this.curr.values = make(map[string]*Histogram)
+	}
+
+	hist, ok := this.curr.values[name]
+	if !ok {
+		hist = NewHistogram(this.curr.hist.Precision())
+		this.curr.values[name] = hist
+	}
+
+	hist.Record(value)
+	this.mu.Unlock()
+}
+
+func (this *recorder) PublishThinkTime(clientId int, d time.Duration) {
+	this.mu.Lock()
+	this.curr.think_sum += int64(d)
+	this.mu.Unlock()
+}
+
+// Swaps in an empty shard, and returns the one that was being
+// recorded into.
+func (this *recorder) swap(empty *shard) (full *shard) {
+	this.mu.Lock()
+	full = this.curr
+	this.curr = empty
+	this.mu.Unlock()
+	return
+}
@@ -0,0 +1,54 @@
+package knock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecorderKeepsNanoseconds(t *testing.T) {
+	rec := NewRecorder(0, DEFAULT_HISTOGRAM_PRECISION)
+
+	rec.PublishResponseTime(0, 350*time.Nanosecond, OpResult{Status: WRK_OK})
+	rec.PublishResponseTime(0, 1250*time.Nanosecond, OpResult{Status: WRK_OK, Label: "get"})
+	rec.PublishThinkTime(0, 40*time.Nanosecond)
+
+	s := rec.swap(newShard(DEFAULT_HISTOGRAM_PRECISION))
+
+	if s.hist.Min() != 350 || s.hist.Max() != 1250 {
+		t.Errorf("expected response times from 350ns to 1250ns, got: %dns to %dns", s.hist.Min(), s.hist.Max())
+		return
+	}
+
+	if s.lag_sum != 1600 || s.think_sum != 40 {
+		t.Errorf("expected sums of 1600ns and 40ns, got: %dns and %dns", s.lag_sum, s.think_sum)
+		return
+	}
+
+	if !expectInt(t, 1250, int(s.labels["get"].lag_sum)) {
+		return
+	}
+}
+
+func TestRecorderKeepsFailedResponseTimes(t *testing.T) {
+	rec := NewRecorder(0, DEFAULT_HISTOGRAM_PRECISION)
+
+	rec.PublishResponseTime(0, time.Millisecond, OpResult{Status: WRK_OK})
+	rec.PublishResponseTime(0, 2*time.Millisecond, OpResult{Status: WRK_ERROR})
+	rec.PublishResponseTime(0, 500*time.Millisecond, OpResult{Status: WRK_TIMEOUT})
+
+	s := rec.swap(newShard(DEFAULT_HISTOGRAM_PRECISION))
+
+	// The failures don't count towards the successful operations.
+	if s.ops != 1 || s.hist.Max() != int64(time.Millisecond) {
+		t.Errorf("expected one operation of 1ms, got: %d of up to %dns", s.ops, s.hist.Max())
+		return
+	}
+
+	if !expectInt(t, 2, int(s.failed[WRK_ERROR].Max()/int64(time.Millisecond))) {
+		return
+	}
+
+	if !expectInt(t, 500, int(s.failed[WRK_TIMEOUT].Max()/int64(time.Millisecond))) {
+		return
+	}
+}
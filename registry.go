@@ -0,0 +1,85 @@
+package knock
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Describes a behavior, so that it can be chosen by name.
+type BehaviorInfo struct {
+	Name        string
+	Description string
+	Properties  []*PropertyInfo
+
+	// Either of these will do; a Factory is adapted into a
+	// ContextFactory when the behavior is registered.
+	Factory        BehaviorFactory
+	ContextFactory ContextBehaviorFactory
+
+	// Sets up before each run, and tears down after it, if the
+	// behavior needs to.
+	Fixture Fixture
+}
+
+// Describes a property which a behavior reads from its Init props.
+type PropertyInfo struct {
+	Name        string
+	Description string
+
+	// The value used when the property isn't given, or "" if the
+	// property is required (or has no default).
+	Default string
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]*BehaviorInfo)
+)
+
+// Makes a behavior available by name.  Behaviors usually register
+// themselves from an init function, so that importing their package
+// is enough to use them.  Registering the same name twice panics.
+func Register(info *BehaviorInfo) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if info == nil || (info.Factory == nil && info.ContextFactory == nil) {
+		panic("knock: Register behavior without a factory")
+	}
+
+	if _, dup := registry[info.Name]; dup {
+		panic(fmt.Sprintf("knock: Register called twice for behavior %q", info.Name))
+	}
+
+	if info.ContextFactory == nil {
+		info.ContextFactory = Adapt(info.Factory)
+	}
+
+	registry[info.Name] = info
+}
+
+// Finds a registered behavior by name.
+func Lookup(name string) (info *BehaviorInfo, ok bool) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	info, ok = registry[name]
+	return
+}
+
+// Every registered behavior, sorted by name.
+func Behaviors() (infos []*BehaviorInfo) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	for _, info := range registry {
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+
+	return
+}
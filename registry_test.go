@@ -0,0 +1,46 @@
+package knock
+
+import (
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	Register(&BehaviorInfo{
+		Name:        "test.dummy",
+		Description: "sleeps",
+		Factory:     func() Behavior { return &dummy_behavior{} },
+	})
+
+	info, ok := Lookup("test.dummy")
+	if !expectBool(t, true, ok) {
+		return
+	}
+
+	if !expectString(t, "sleeps", info.Description) {
+		return
+	}
+
+	if _, ok = Lookup("test.missing"); !expectBool(t, false, ok) {
+		return
+	}
+
+	found := false
+	for _, info := range Behaviors() {
+		found = found || info.Name == "test.dummy"
+	}
+
+	if !expectBool(t, true, found) {
+		return
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected registering the same name twice to panic")
+		}
+	}()
+
+	Register(&BehaviorInfo{
+		Name:    "test.dummy",
+		Factory: func() Behavior { return &dummy_behavior{} },
+	})
+}
@@ -0,0 +1,72 @@
+package knock
+
+import (
+	"context"
+)
+
+// The outcome of a run.
+type Result interface {
+	Statistics
+
+	// The configuration of the run, with the defaults filled in.
+	Config() *Config
+}
+
+// Runs a benchmark, and blocks until it finishes.  Cancelling the
+// context stops the run early: the clients finish their current
+// operations, and the result covers the run so far.
+//
+// The error is non-nil if the configuration is invalid, if the
+// fixture couldn't be set up or torn down, or if a client's behavior
+// failed to initialize.  Unless the run never started, the result
+// still holds whatever was measured before it stopped.
+func Run(ctx context.Context, conf Config, factory BehaviorFactory) (res Result, err error) {
+	return RunContextBehavior(ctx, conf, Adapt(factory))
+}
+
+// Runs a benchmark of a behavior which can be cancelled, like Run.
+// Cancelling the context also cancels the operations in flight.
+func RunContextBehavior(ctx context.Context, conf Config, factory ContextBehaviorFactory) (res Result, err error) {
+	err = conf.Validate()
+	if err != nil {
+		return
+	}
+
+	teardown, err := conf.setupFixtures()
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if e := teardown(); e != nil && err == nil {
+			err = e
+		}
+	}()
+
+	m := NewMaster(ctx, &conf, factory)
+	m.Start()
+
+	done := ctx.Done()
+	events := m.SummaryEvents()
+
+	for {
+		select {
+		case <-done:
+			done = nil
+			go m.Interrupt()
+
+		case <-m.t.Dead():
+			return m.stats, m.Err()
+
+		case u, ok := <-events:
+			if !ok {
+				events = nil
+				break
+			}
+
+			if conf.OnSummary != nil {
+				conf.OnSummary(u)
+			}
+		}
+	}
+}
@@ -0,0 +1,728 @@
+package knock
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	summaries := 0
+	var first *SummaryEvent
+
+	conf := Config{
+		Clients:  2,
+		Duration: 60 * time.Second,
+		OnSummary: func(evt *SummaryEvent) {
+			summaries += 1
+			if first == nil {
+				first = evt
+			}
+			if summaries == 2 {
+				cancel()
+			}
+		},
+	}
+
+	res, err := Run(ctx, conf, func() Behavior {
+		return &dummy_behavior{sleep: 1 * time.Millisecond}
+	})
+
+	if !expectOk(t, err) {
+		return
+	}
+
+	if !expectBool(t, true, res.Interrupted()) {
+		return
+	}
+
+	if res.Operations() == 0 {
+		t.Error("expected some operations before the run was cancelled")
+		return
+	}
+
+	if summaries < 2 {
+		t.Errorf("expected at least 2 summaries, got: %d", summaries)
+		return
+	}
+
+	// Every operation sleeps for at least a millisecond.
+	if first.Percentile != DEFAULT_SUMMARY_PERCENTILE || first.PercentileResponseTime < time.Millisecond {
+		t.Errorf("expected a rolling p99 of at least 1ms, got: p%v of %s", first.Percentile, first.PercentileResponseTime)
+		return
+	}
+
+	if !expectInt(t, 2, res.Config().MaxClients()) {
+		return
+	}
+
+	if len(res.Histogram2().Rows) == 0 {
+		t.Error("expected a histogram")
+		return
+	}
+}
+
+func TestRunRejectsInvalidConfig(t *testing.T) {
+	_, err := Run(context.Background(), Config{Clients: 1}, func() Behavior {
+		return &dummy_behavior{}
+	})
+
+	if err == nil {
+		t.Error("expected an error for a run without a duration")
+		return
+	}
+
+	conf := Config{
+		Clients:    1,
+		Duration:   time.Second,
+		Rate:       100,
+		Properties: map[string]string{"internals.ArrivalQueueSize": "0"},
+	}
+
+	_, err = Run(context.Background(), conf, func() Behavior {
+		return &dummy_behavior{}
+	})
+
+	if err == nil {
+		t.Error("expected an error for a bad internals.ArrivalQueueSize")
+		return
+	}
+}
+
+func TestRunFailsWhenBehaviorCantInitialize(t *testing.T) {
+	conf := Config{Clients: 4, Duration: 60 * time.Second}
+
+	res, err := Run(context.Background(), conf, func() Behavior {
+		return &broken_behavior{}
+	})
+
+	if err == nil {
+		t.Error("expected an error when the behavior can't initialize")
+		return
+	}
+
+	if res == nil || res.RunTime() > 5*time.Second {
+		t.Error("expected the run to stop straight away")
+		return
+	}
+}
+
+// Never initializes.
+type broken_behavior struct {
+	dummy_behavior
+}
+
+func (*broken_behavior) Init(props map[string]string) (err error) {
+	return errors.New("broken")
+}
+
+func TestRunContextBehaviorCancelsOperations(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	conf := Config{Clients: 2, Duration: 60 * time.Second}
+
+	res, err := RunContextBehavior(ctx, conf, func() ContextBehavior {
+		return &blocking_behavior{}
+	})
+
+	if !expectOk(t, err) {
+		return
+	}
+
+	if res.RunTime() > 5*time.Second {
+		t.Errorf("expected the operations to be cancelled, but the run took %s", res.RunTime())
+		return
+	}
+
+	if !expectInt(t, 0, res.Errors()[WRK_ERROR]) {
+		return
+	}
+}
+
+// Sends and receives a fixed number of bytes per operation.
+type sized_behavior struct {
+	dummy_behavior
+}
+
+func (*sized_behavior) WorkSized(t0 time.Time) (res OpResult) {
+	return OpResult{Status: WRK_OK, RequestBytes: 100, ResponseBytes: 300}
+}
+
+// Alternates between reads and writes.
+type mixed_behavior struct {
+	dummy_behavior
+	n int
+}
+
+func (this *mixed_behavior) WorkSized(t0 time.Time) (res OpResult) {
+	this.n += 1
+	if this.n%2 == 0 {
+		return OpResult{Status: WRK_OK, Label: "read"}
+	}
+
+	return OpResult{Status: WRK_OK, Label: "write"}
+}
+
+func TestRunKeepsStatisticsPerLabel(t *testing.T) {
+	conf := Config{Clients: 2, ClientOps: 50}
+
+	res, err := Run(context.Background(), conf, func() Behavior {
+		return &mixed_behavior{}
+	})
+
+	if !expectOk(t, err) {
+		return
+	}
+
+	labels := res.Labels()
+	if !expectInt(t, 2, len(labels)) {
+		return
+	}
+
+	if !expectString(t, "read", labels[0].Label) || !expectString(t, "write", labels[1].Label) {
+		return
+	}
+
+	for _, l := range labels {
+		if !expectInt(t, 50, int(l.Operations)) {
+			return
+		}
+
+		if len(l.Histogram.Rows) == 0 || l.Throughput <= 0 {
+			t.Errorf("%s: expected a histogram and a throughput", l.Label)
+			return
+		}
+	}
+}
+
+func TestRunCountsBytes(t *testing.T) {
+	conf := Config{Clients: 2, ClientOps: 50}
+
+	res, err := Run(context.Background(), conf, func() Behavior {
+		return &sized_behavior{}
+	})
+
+	if !expectOk(t, err) {
+		return
+	}
+
+	if !expectInt(t, 100, int(res.Operations())) {
+		return
+	}
+
+	if res.RequestBytes() != 100*100 || res.ResponseBytes() != 300*100 {
+		t.Errorf("expected 10000 bytes sent and 30000 received, got: %d and %d", res.RequestBytes(), res.ResponseBytes())
+		return
+	}
+
+	req, resp := res.Bandwidth()
+	if req <= 0 || resp <= req {
+		t.Errorf("expected the bandwidth to follow the byte counts, got: %f and %f", req, resp)
+		return
+	}
+}
+
+// Counts its calls, and checks that they happen in the right order.
+type counting_fixture struct {
+	mu        sync.Mutex
+	setups    int
+	teardowns int
+	inits     int
+	closes    int
+	t         *testing.T
+}
+
+func (this *counting_fixture) Setup(props map[string]string) (value interface{}, err error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.inits > 0 {
+		this.t.Error("expected the fixture to be set up before any client starts")
+	}
+
+	this.setups += 1
+	return "fixture", nil
+}
+
+func (this *counting_fixture) Teardown(props map[string]string) (err error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.closes != this.inits {
+		this.t.Errorf("expected every client to close before teardown, got: %d of %d", this.closes, this.inits)
+	}
+
+	this.teardowns += 1
+	return
+}
+
+// Checks that it's given the fixture's value.
+type fixture_behavior struct {
+	dummy_behavior
+	fixture *counting_fixture
+}
+
+func (this *fixture_behavior) InitEnv(env *Env, props map[string]string) (err error) {
+	this.fixture.mu.Lock()
+	defer this.fixture.mu.Unlock()
+
+	if env.Fixture != "fixture" {
+		this.fixture.t.Errorf("expected the fixture's value, got: %v", env.Fixture)
+	}
+
+	this.fixture.inits += 1
+	return
+}
+
+func (this *fixture_behavior) Close() {
+	this.fixture.mu.Lock()
+	defer this.fixture.mu.Unlock()
+
+	this.fixture.closes += 1
+}
+
+func TestRunSetsUpAndTearsDownFixture(t *testing.T) {
+	fixture := &counting_fixture{t: t}
+	conf := Config{Clients: 4, ClientOps: 10, Fixture: fixture}
+
+	_, err := Run(context.Background(), conf, func() Behavior {
+		return &fixture_behavior{fixture: fixture}
+	})
+
+	if !expectOk(t, err) {
+		return
+	}
+
+	if fixture.setups != 1 || fixture.teardowns != 1 {
+		t.Errorf("expected one setup and one teardown, got: %d and %d", fixture.setups, fixture.teardowns)
+		return
+	}
+
+	if !expectInt(t, 4, fixture.inits) {
+		return
+	}
+}
+
+// Only returns a while after its operation times out, so that its
+// client has to close it in the background.
+type slow_fixture_behavior struct {
+	fixture *counting_fixture
+}
+
+func (this *slow_fixture_behavior) Init(ctx context.Context, props map[string]string) (err error) {
+	this.fixture.mu.Lock()
+	defer this.fixture.mu.Unlock()
+
+	this.fixture.inits += 1
+	return
+}
+
+func (this *slow_fixture_behavior) Close(ctx context.Context) {
+	this.fixture.mu.Lock()
+	defer this.fixture.mu.Unlock()
+
+	this.fixture.closes += 1
+}
+
+func (this *slow_fixture_behavior) Work(ctx context.Context) (res OpResult) {
+	<-ctx.Done()
+	<-time.After(50 * time.Millisecond)
+	return OpResult{Status: WRK_ERROR}
+}
+
+func TestRunTearsDownFixtureAfterTimedOutBehaviors(t *testing.T) {
+	fixture := &counting_fixture{t: t}
+	conf := Config{
+		Clients:   2,
+		Duration:  200 * time.Millisecond,
+		OpTimeout: 10 * time.Millisecond,
+		Fixture:   fixture,
+	}
+
+	_, err := RunContextBehavior(context.Background(), conf, func() ContextBehavior {
+		return &slow_fixture_behavior{fixture: fixture}
+	})
+
+	if !expectOk(t, err) {
+		return
+	}
+
+	if !expectInt(t, 1, fixture.teardowns) {
+		return
+	}
+
+	if fixture.inits <= 2 {
+		t.Errorf("expected the behaviors to be re-initialized, got: %d inits", fixture.inits)
+		return
+	}
+}
+
+// Needs the "run" property, which only the groups give it, and hands
+// each group a value of its own.
+type run_fixture struct {
+	mu        sync.Mutex
+	setups    []string
+	teardowns []string
+}
+
+func (this *run_fixture) Setup(props map[string]string) (value interface{}, err error) {
+	run, ok := props["run"]
+	if !ok {
+		return nil, errors.New("run is a required property")
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.setups = append(this.setups, run)
+	return "fixture:" + run, nil
+}
+
+func (this *run_fixture) Teardown(props map[string]string) (err error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.teardowns = append(this.teardowns, props["run"])
+	return
+}
+
+// Checks that it's given its group's fixture value.
+type run_fixture_behavior struct {
+	dummy_behavior
+	t *testing.T
+}
+
+func (this *run_fixture_behavior) InitEnv(env *Env, props map[string]string) (err error) {
+	if env.Fixture != "fixture:"+props["run"] {
+		this.t.Errorf("expected the fixture's value for %s, got: %v", props["run"], env.Fixture)
+	}
+
+	return
+}
+
+func TestRunSetsUpFixturesPerGroup(t *testing.T) {
+	fixture := &run_fixture{}
+	own := &counting_fixture{t: t}
+
+	conf := Config{
+		ClientOps: 10,
+		Fixture:   fixture,
+		Groups: []*Group{
+			{Name: "writers", Clients: 2, Properties: map[string]string{"run": "writes"}},
+			{Name: "readers", Clients: 2, Properties: map[string]string{"run": "reads"}},
+			{
+				Name:    "own",
+				Clients: 1,
+				Factory: Adapt(func() Behavior { return &fixture_behavior{fixture: own} }),
+				Fixture: own,
+			},
+		},
+	}
+
+	_, err := Run(context.Background(), conf, func() Behavior {
+		return &run_fixture_behavior{t: t}
+	})
+
+	if !expectOk(t, err) {
+		return
+	}
+
+	if !expectString(t, "writes,reads", strings.Join(fixture.setups, ",")) {
+		return
+	}
+
+	if !expectString(t, "reads,writes", strings.Join(fixture.teardowns, ",")) {
+		return
+	}
+
+	if own.setups != 1 || own.teardowns != 1 {
+		t.Errorf("expected the group's own fixture to be set up and torn down once, got: %d and %d", own.setups, own.teardowns)
+		return
+	}
+
+	if !expectInt(t, 1, own.inits) {
+		return
+	}
+}
+
+// Remembers the properties it was given.
+type props_behavior struct {
+	dummy_behavior
+	mu    *sync.Mutex
+	props *[]map[string]string
+}
+
+func (this *props_behavior) Init(props map[string]string) (err error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	*this.props = append(*this.props, props)
+	return
+}
+
+func TestRunGroups(t *testing.T) {
+	var mu sync.Mutex
+	props := []map[string]string{}
+
+	conf := Config{
+		ClientOps:  20,
+		Properties: map[string]string{"run": "writes", "url": "here"},
+		Groups: []*Group{
+			{Name: "writers", Clients: 3},
+			{Name: "readers", Clients: 2, Properties: map[string]string{"run": "reads"}},
+			{Name: "mixed", Clients: 1, Factory: Adapt(func() Behavior { return &mixed_behavior{} })},
+		},
+	}
+
+	res, err := Run(context.Background(), conf, func() Behavior {
+		return &props_behavior{mu: &mu, props: &props}
+	})
+
+	if !expectOk(t, err) {
+		return
+	}
+
+	if !expectInt(t, 6, res.Config().Clients) {
+		return
+	}
+
+	runs := map[string]int{}
+	for _, p := range props {
+		if !expectString(t, "here", p["url"]) {
+			return
+		}
+
+		runs[p["run"]] += 1
+	}
+
+	if runs["writes"] != 3 || runs["reads"] != 2 {
+		t.Errorf("expected 3 writers and 2 readers, got: %v", runs)
+		return
+	}
+
+	groups := res.Groups()
+	if !expectInt(t, 3, len(groups)) {
+		return
+	}
+
+	total := int64(0)
+	for i, name := range []string{"writers", "readers", "mixed"} {
+		if !expectString(t, name, groups[i].Name) {
+			return
+		}
+
+		if !expectInt(t, 20*groups[i].Clients, int(groups[i].Operations)) {
+			return
+		}
+
+		total += groups[i].Operations
+	}
+
+	if total != res.Operations() {
+		t.Errorf("expected the groups to add up to %d operations, got: %d", res.Operations(), total)
+		return
+	}
+
+	// Only the mixed group labels its operations.
+	if !expectInt(t, 2, len(res.Labels())) {
+		return
+	}
+}
+
+func TestRunRejectsInvalidGroups(t *testing.T) {
+	invalid := [][]*Group{
+		{{Name: "a", Clients: 1}, {Name: "a", Clients: 1}},
+		{{Name: "", Clients: 1}},
+		{{Name: "a", Clients: 0}},
+	}
+
+	for _, groups := range invalid {
+		conf := Config{Duration: time.Second, Groups: groups}
+
+		if err := conf.Validate(); err == nil {
+			t.Errorf("expected an error for groups %v", groups)
+			return
+		}
+	}
+
+	conf := Config{Profile: "hold 10s", Clients: 1, Groups: []*Group{{Name: "a", Clients: 1}}}
+	if err := conf.Validate(); err == nil {
+		t.Error("expected an error for groups with a load profile")
+		return
+	}
+}
+
+// Stalls on one operation in a hundred.
+type stalling_behavior struct {
+	dummy_behavior
+	n int
+}
+
+func (this *stalling_behavior) Work(t0 time.Time) (res WorkResult) {
+	this.n += 1
+	if this.n%100 == 50 {
+		time.Sleep(100 * time.Millisecond)
+	} else {
+		time.Sleep(time.Millisecond)
+	}
+
+	return WRK_OK
+}
+
+func TestRunCorrectsForCoordinatedOmission(t *testing.T) {
+	conf := Config{Clients: 2, ClientOps: 100, ExpectedInterval: time.Millisecond}
+
+	res, err := Run(context.Background(), conf, func() Behavior {
+		return &stalling_behavior{}
+	})
+
+	if !expectOk(t, err) {
+		return
+	}
+
+	corrected, interval, ok := res.Corrected()
+	if !expectBool(t, true, ok) || interval != time.Millisecond {
+		t.Errorf("expected an interval of 1ms, got: %s", interval)
+		return
+	}
+
+	// Each stall hides about a hundred operations.
+	uncorrected := res.Histogram2()
+	if uncorrected.P95 > int64(50*time.Millisecond) || corrected.P95 < int64(50*time.Millisecond) {
+		t.Errorf("expected the stalls to show in the corrected p95 only, got: %s and %s",
+			time.Duration(uncorrected.P95), time.Duration(corrected.P95))
+		return
+	}
+
+	_, err = Run(context.Background(), Config{Clients: 1, Rate: 100, Duration: time.Second, CorrectOmission: true}, func() Behavior {
+		return &dummy_behavior{}
+	})
+
+	if err == nil {
+		t.Error("expected an error for an open-loop run")
+		return
+	}
+}
+
+func TestRunKeepsTimeline(t *testing.T) {
+	conf := Config{Clients: 2, Duration: 2 * time.Second}
+
+	res, err := Run(context.Background(), conf, func() Behavior {
+		return &dummy_behavior{sleep: time.Millisecond}
+	})
+
+	if !expectOk(t, err) {
+		return
+	}
+
+	timeline := res.Timeline()
+	if len(timeline) < 2 {
+		t.Errorf("expected an interval per second, got: %d", len(timeline))
+		return
+	}
+
+	ops := int64(0)
+	prev := time.Duration(0)
+
+	for _, r := range timeline {
+		ops += r.Operations
+
+		if r.Elapsed < prev || r.Elapsed-prev != r.Duration {
+			t.Errorf("expected the intervals to follow each other, got one of %s ending at %s", r.Duration, r.Elapsed)
+			return
+		}
+
+		prev = r.Elapsed
+
+		if !expectInt(t, 2, r.Clients) {
+			return
+		}
+
+		if r.Operations > 0 && (r.P50 < time.Millisecond || r.P99 < r.P50 || r.Max < r.P99) {
+			t.Errorf("expected ordered percentiles of at least 1ms, got: %s, %s and %s", r.P50, r.P99, r.Max)
+			return
+		}
+	}
+
+	// Each interval counts its own operations, not those before it.
+	if ops != res.Operations() {
+		t.Errorf("expected the intervals to add up to %d operations, got: %d", res.Operations(), ops)
+		return
+	}
+}
+
+func TestTimelineKeepsLateOperations(t *testing.T) {
+	conf := &Config{Clients: 1, Duration: time.Second}
+	if !expectOk(t, conf.Validate()) {
+		return
+	}
+
+	c := NewCalculator(conf, nil, nil, nil, time.Now())
+
+	c.curr_ops_sum = 5
+	c.keepInterval(time.Second)
+
+	// Operations which land after the measured time has run out
+	// still belong in the timeline.
+	c.curr_ops_sum = 3
+	c.keepInterval(time.Second)
+
+	// An interval without any measured time or operations doesn't.
+	c.curr_ops_sum = 0
+	c.keepInterval(time.Second)
+
+	timeline := c.Timeline()
+	if !expectInt(t, 2, len(timeline)) {
+		return
+	}
+
+	if timeline[0].Throughput != 5 {
+		t.Errorf("expected a throughput of 5 ops/sec, got: %f", timeline[0].Throughput)
+		return
+	}
+
+	if !expectInt(t, 3, int(timeline[1].Operations)) {
+		return
+	}
+
+	if timeline[1].Duration != 0 || timeline[1].Throughput != 0 {
+		t.Errorf("expected no measured time and a throughput of 0, got: %s and %f", timeline[1].Duration, timeline[1].Throughput)
+		return
+	}
+}
+
+func TestRunKeepsFailedResponseTimes(t *testing.T) {
+	const OpTimeout = 10 * time.Millisecond
+
+	conf := Config{Clients: 2, Duration: 500 * time.Millisecond, OpTimeout: OpTimeout}
+
+	res, err := RunContextBehavior(context.Background(), conf, func() ContextBehavior {
+		return &blocking_behavior{}
+	})
+
+	if !expectOk(t, err) {
+		return
+	}
+
+	timeouts, ok := res.FailedResponseTimes()[WRK_TIMEOUT]
+	if !ok {
+		t.Error("expected the response times of the timeouts")
+		return
+	}
+
+	if !expectInt(t, res.Errors()[WRK_TIMEOUT], int(timeouts.Count)) {
+		return
+	}
+
+	if timeouts.Min < int64(OpTimeout) {
+		t.Errorf("expected the timeouts to take at least %s, got: %s", OpTimeout, time.Duration(timeouts.Min))
+		return
+	}
+}
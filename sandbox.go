@@ -1,101 +1,320 @@
-package main
+package knock
 
 import (
-	"errors"
-	_ "launchpad.net/tomb"
+	"context"
+	"fmt"
+	"launchpad.net/tomb"
 	"log"
 	_ "math"
-	"strconv"
+	"math/rand"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+const (
+	TIMEOUT_REINIT  = "reinit"
+	TIMEOUT_ABANDON = "abandon"
+
+	// How long a behavior is given to close, once its client is done.
+	BEHAVIOR_CLOSE_TIMEOUT = 5 * time.Second
+)
+
 type SandboxInfo struct {
-	Id         int
-	Properties map[string]string
-	Duration   time.Duration
-	StartTime  time.Time
-	Emitter    LatencyEmitter
-	WaitGroup  *sync.WaitGroup
-	Factory    BehaviorFactory
+	Context     context.Context
+	Id          int
+	Clients     int
+	Seed        int64
+	Shared      *SharedState
+	Fixture     interface{}
+	Properties  map[string]string
+	Duration    time.Duration
+	Warmup      time.Duration
+	Cooldown    time.Duration
+	StartTime   time.Time
+	Emitter     LatencyEmitter
+	Metrics     Metrics
+	Supervisor  FailureEmitter
+	WaitGroup   *sync.WaitGroup
+	Factory     ContextBehaviorFactory
+	Scheduler   *scheduler
+	Budget      *opBudget
+	OpsLimit    int
+	OpTimeout   time.Duration
+	OnTimeout   string
+	ReinitAfter int
+	Think       *thinkTime
+	Pace        time.Duration
 }
 
 type sandbox struct {
-	id            int
-	props         map[string]string
-	d             time.Duration
-	start         time.Time
-	emitter       LatencyEmitter
-	wg            *sync.WaitGroup
-	behavior      Behavior
-	factory       BehaviorFactory
-	stall         bool
-	opsPerStall   int
-	stall_counter int
-	stalls        int
+	t           tomb.Tomb
+	ctx         context.Context
+	cancel      context.CancelFunc
+	id          int
+	clients     int
+	seed        int64
+	shared      *SharedState
+	fixture     interface{}
+	env         *Env
+	bctx        context.Context
+	props       map[string]string
+	d           time.Duration
+	warmup      time.Duration
+	cooldown    time.Duration
+	start       time.Time
+	emitter     LatencyEmitter
+	metrics     *phasedMetrics
+	supervisor  FailureEmitter
+	wg          *sync.WaitGroup
+	behavior    ContextBehavior
+	factory     ContextBehaviorFactory
+	sched       *scheduler
+	budget      *opBudget
+	opsLimit    int
+	ops         int
+	opTimeout   time.Duration
+	onTimeout   string
+	opCtx       *opContext
+	worker      *opWorker
+	opTimer     *time.Timer
+	pending     chan *workOutcome
+	timeouts    int
+	reinitAfter int
+	failures    int
+	panics      int
+	reinits     int
+	inits       int
+	released    int32
+	think       *thinkTime
+	pace        time.Duration
+	rng         *rand.Rand
+	timer       *time.Timer
 }
 
 func NewSandbox(info *SandboxInfo) *sandbox {
-	return &sandbox{
-		id:      info.Id,
-		props:   info.Properties,
-		d:       info.Duration,
-		start:   info.StartTime,
-		emitter: info.Emitter,
-		wg:      info.WaitGroup,
-		factory: info.Factory,
+	parent := info.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+
+	// The context is done once the run is over, or the client has
+	// been retired, which cancels any operation still in flight.
+	ctx, cancel := context.WithDeadline(parent, info.StartTime.Add(info.Duration))
+
+	shared := info.Shared
+	if shared == nil {
+		shared = NewSharedState()
 	}
+
+	var metrics Metrics = discardMetrics{}
+	if info.Metrics != nil {
+		metrics = info.Metrics
+	}
+
+	this := &sandbox{
+		ctx:         ctx,
+		cancel:      cancel,
+		id:          info.Id,
+		clients:     info.Clients,
+		seed:        info.Seed,
+		shared:      shared,
+		fixture:     info.Fixture,
+		props:       info.Properties,
+		d:           info.Duration,
+		warmup:      info.Warmup,
+		cooldown:    info.Cooldown,
+		start:       info.StartTime,
+		emitter:     info.Emitter,
+		supervisor:  info.Supervisor,
+		wg:          info.WaitGroup,
+		factory:     info.Factory,
+		sched:       info.Scheduler,
+		budget:      info.Budget,
+		opsLimit:    info.OpsLimit,
+		opTimeout:   info.OpTimeout,
+		onTimeout:   info.OnTimeout,
+		reinitAfter: info.ReinitAfter,
+		think:       info.Think,
+		pace:        info.Pace,
+		rng:         rand.New(rand.NewSource(time.Now().UnixNano() + int64(info.Id))),
+	}
+
+	this.metrics = &phasedMetrics{this, metrics}
+	return this
 }
 
 func (this *sandbox) Start() {
 	go this.loop()
 }
 
-// func (this *sandbox) Stop() (err error) {
-// 	this.t.Kill(nil)
-// 	return this.t.Wait()
-// }
+func (this *sandbox) Stop() (err error) {
+	this.Retire()
+	return this.t.Wait()
+}
+
+// Asks the sandbox to stop, cancelling its current operation, without
+// waiting for it to do so.
+func (this *sandbox) Retire() {
+	this.t.Kill(nil)
+	this.cancel()
+}
+
+// Retires the client before the end of the run, for good, so that
+// the gauges its behavior set no longer count once it's gone.
+func (this *sandbox) Release() {
+	atomic.StoreInt32(&this.released, 1)
+	this.Retire()
+}
 
 func (this *sandbox) loop() {
-	//defer this.t.Done()
+	defer this.t.Done()
+	defer this.teardown()
 
-	this.setup()
+	if !this.setup() {
+		return
+	}
 
-	defer this.teardown()
+	for {
+		t0, ok := this.next()
+		if !ok {
+			break
+		}
 
-	for !this.expired() {
-		this.update()
+		this.update(t0)
+		this.pause(t0)
 	}
 }
 
-func (this *sandbox) setup() {
-	err := this.parseProperties()
-	if err != nil {
-		log.Fatal(err)
+// Waits between operations, either for a think time, or until the
+// end of the current cycle when pacing.
+func (this *sandbox) pause(t0 time.Time) {
+	var d time.Duration
+
+	switch {
+	case this.pace > 0:
+		d = this.pace - time.Since(t0)
+	case this.think != nil:
+		d = this.think.next(this.rng)
+	}
+
+	if d <= 0 {
+		return
+	}
+
+	if this.timer == nil {
+		this.timer = time.NewTimer(d)
+	} else {
+		this.timer.Reset(d)
+	}
+
+	// A retired client doesn't need its timer again, and neither
+	// does one whose run is over.
+	select {
+	case <-this.timer.C:
+	case <-this.ctx.Done():
+		return
+	}
+
+	if t1 := time.Now(); this.measuring(t1) {
+		this.emitter.PublishThinkTime(this.id, d)
+	}
+}
+
+// Returns the intended start time of the next operation.  In a
+// closed loop, that's right now; in an open loop, it's whenever
+// the scheduler says so.
+func (this *sandbox) next() (t0 time.Time, ok bool) {
+	if this.sched == nil {
+		return time.Now(), !this.expired() && !this.retired() && !this.spent()
+	}
+
+	if this.spent() {
+		return
+	}
+
+	select {
+	case t0, ok = <-this.sched.Arrivals():
+		if ok && this.expired() {
+			this.sched.markDropped()
+			ok = false
+		}
+
+	case <-this.t.Dying():
+		ok = false
+
+	case <-this.budgetDone():
+		ok = false
+	}
+
+	return
+}
+
+// Whether the run's operation budget, or this client's share of
+// it, has been used up.
+func (this *sandbox) spent() (ok bool) {
+	if this.budget != nil && this.budget.exhausted() {
+		return true
+	}
+
+	return this.opsLimit > 0 && this.ops >= this.opsLimit
+}
+
+func (this *sandbox) budgetDone() <-chan struct{} {
+	if this.budget == nil {
+		return nil
 	}
 
+	return this.budget.Done()
+}
+
+// Whether an operation completing at the given time counts towards
+// the statistics and the budgets, i.e. whether it falls between the
+// warmup and cooldown phases.
+func (this *sandbox) measuring(t1 time.Time) (ok bool) {
+	d := t1.Sub(this.start)
+	return d >= this.warmup && d < this.d-this.cooldown
+}
+
+// Initializes the behavior.  A client which can't get started tells
+// its supervisor, and doesn't run at all.
+func (this *sandbox) setup() (ok bool) {
 	res, err := this.init()
 	if err != nil {
-		log.Fatal(err)
+		if this.supervisor == nil {
+			this.env.Log.Printf("behavior failed to initialize: %+v", err)
+		} else {
+			this.supervisor.PublishFailure(this.id, err)
+		}
+
+		return false
 	}
 
 	this.behavior = res
+	return true
 }
 
-func (this *sandbox) init() (res Behavior, err error) {
+// Builds an environment for a new behavior, and initializes it.  A
+// re-initialized behavior gets an environment of its own, since an
+// operation abandoned by the one it replaces may still be using the
+// old one's Rand.
+func (this *sandbox) init() (res ContextBehavior, err error) {
 	defer func() {
 		e := recover()
 		if e != nil {
-			if u, ok := e.(error); ok {
-				err = u
-			}
+			err = asError(e)
 		}
 
 		return
 	}()
 
+	this.env = this.newEnv()
+	this.bctx = withEnv(this.ctx, this.env)
+	this.opCtx = newOpContext(this.bctx, false)
+
 	res = this.factory()
-	err = res.Init(this.props)
+	err = res.Init(this.bctx, this.props)
 	if err != nil {
 		return
 	}
@@ -103,56 +322,350 @@ func (this *sandbox) init() (res Behavior, err error) {
 	return
 }
 
+// The first behavior's Rand is seeded from the run's seed and the
+// client id; those of re-initialized behaviors are seeded from how
+// many came before them as well.
+func (this *sandbox) newEnv() *Env {
+	seed := this.seed + int64(this.id) + int64(this.inits)<<32
+	this.inits += 1
+
+	return &Env{
+		ClientId: this.id,
+		Clients:  this.clients,
+		Rand:     rand.New(rand.NewSource(seed)),
+		Log:      log.New(os.Stderr, fmt.Sprintf("client %d: ", this.id), log.LstdFlags),
+		Shared:   this.shared,
+		Metrics:  this.metrics,
+		Fixture:  this.fixture,
+	}
+}
+
 func (this *sandbox) expired() (ok bool) {
 	return time.Since(this.start) > this.d
 }
 
-func (this *sandbox) update() {
-	err := this.work()
+func (this *sandbox) retired() (ok bool) {
+	select {
+	case <-this.t.Dying():
+		return true
+	default:
+		return false
+	}
+}
+
+func (this *sandbox) update(t0 time.Time) {
+	// Open-loop response times are measured from the intended
+	// start time, so that any queueing delay is included.
+	if this.sched != nil && time.Since(t0) > ARRIVAL_LATE_THRESHOLD {
+		this.sched.markLate()
+	}
+
+	res, err := this.work(t0)
+	t1 := time.Now()
+	latency := t1.Sub(t0)
+
+	// Operations cut short by the end of the run (or by the client
+	// being retired) aren't worth recording.
+	if this.ctx.Err() != nil {
+		return
+	}
+
+	// A panic is just another failed operation, but the first one
+	// is worth a log message.
 	if err != nil {
-		log.Fatalf("behavior panic during Work: %+v", err)
+		if this.panics == 0 {
+			this.env.Log.Printf("behavior panic during Work (further panics are only counted): %+v", err)
+		}
+
+		this.panics += 1
+	}
+
+	this.track(res)
+
+	// Operations from the warmup and cooldown phases run, but
+	// are otherwise ignored.
+	if !this.measuring(t1) {
+		return
 	}
+
+	// Operations which complete after the budget has been spent
+	// are discarded, so that the run performs exactly as many as
+	// were asked for.
+	if res.Status == WRK_OK {
+		this.ops += 1
+
+		if this.budget != nil && !this.budget.spend() {
+			return
+		}
+	}
+
+	this.emitter.PublishResponseTime(this.id, latency, res)
 }
 
-func (this *sandbox) work() (err error) {
+// Performs one unit of work, turning a panic into an error.
+func (this *sandbox) work(t0 time.Time) (res OpResult, err error) {
 	defer func() {
 		e := recover()
 		if e != nil {
-			if u, ok := e.(error); ok {
-				err = u
-			}
+			res = OpResult{Status: WRK_ERROR}
+			err = asError(e)
 		}
 
 		return
 	}()
 
-	t0 := time.Now()
-	res := this.behavior.Work(t0)
-	d := time.Since(t0)
-	usec := int64(d / time.Microsecond)
-
-	// If stalling is enabled, then introduce a 1s pause
-	// every N ops. Hopefully, this will fix the issue with
-	// some Work operations completing far too fast for
-	// the progress/stats reporting goroutines to work.
-	// I'm not sure why the select{} construct isn't picking
-	// the other channels...
-	if this.stall {
-		this.stall_counter += 1
-
-		if this.stall_counter > this.opsPerStall {
-			this.stalls += 1
-			this.stall_counter = 0
-			<-time.After(1 * time.Second)
+	res = this.call(t0)
+	return
+}
+
+// Counts consecutive failures, and re-initializes the behavior
+// once there have been too many of them.
+func (this *sandbox) track(res OpResult) {
+	if res.Status != WRK_ERROR {
+		this.failures = 0
+		return
+	}
+
+	this.failures += 1
+
+	if this.reinitAfter > 0 && this.failures >= this.reinitAfter {
+		this.failures = 0
+		this.close()
+		this.reinit()
+	}
+}
+
+// Replaces the behavior with a freshly initialized one.  If that
+// fails, the client gives up and retires.
+func (this *sandbox) reinit() {
+	res, err := this.init()
+	if err != nil {
+		this.env.Log.Printf("behavior failed to re-initialize, retiring: %+v", err)
+		this.behavior = nil
+		this.Retire()
+		return
+	}
+
+	this.behavior = res
+	this.reinits += 1
+}
+
+func asError(e interface{}) error {
+	if u, ok := e.(error); ok {
+		return u
+	}
+
+	return fmt.Errorf("%v", e)
+}
+
+type workOutcome struct {
+	res OpResult
+	err interface{}
+}
+
+// Runs a client's timed operations, one at a time, so that an
+// operation doesn't cost a goroutine and a context of its own.  A
+// worker whose operation times out is left to finish it, and the
+// client starts another.
+type opWorker struct {
+	behavior ContextBehavior
+	ctx      *opContext
+	work     chan struct{}
+	done     chan *workOutcome
+}
+
+func newOpWorker(ctx context.Context, behavior ContextBehavior) *opWorker {
+	this := &opWorker{
+		behavior: behavior,
+		ctx:      newOpContext(ctx, true),
+		work:     make(chan struct{}),
+		done:     make(chan *workOutcome, 1),
+	}
+
+	go this.loop()
+	return this
+}
+
+func (this *opWorker) loop() {
+	for _ = range this.work {
+		this.done <- this.run()
+	}
+}
+
+func (this *opWorker) run() (u *workOutcome) {
+	defer func() {
+		if e := recover(); e != nil {
+			u = &workOutcome{OpResult{Status: WRK_ERROR}, e}
+		}
+	}()
+
+	return &workOutcome{this.behavior.Work(this.ctx), nil}
+}
+
+// Returns the worker for the current behavior, starting one if need be.
+func (this *sandbox) workerOf(behavior ContextBehavior) *opWorker {
+	if this.worker != nil && this.worker.behavior == behavior {
+		return this.worker
+	}
+
+	this.stopWorker()
+	this.worker = newOpWorker(this.bctx, behavior)
+	return this.worker
+}
+
+// Lets the worker go once it's done with its current operation, if any.
+func (this *sandbox) stopWorker() {
+	if this.worker != nil {
+		close(this.worker.work)
+		this.worker = nil
+	}
+}
+
+// Performs one unit of work, giving up on it once the operation
+// timeout elapses.  A timed out operation keeps running in the
+// background; depending on the policy, the client either waits for
+// it to finish before starting the next one, or replaces its behavior
+// with a freshly initialized one straight away.
+func (this *sandbox) call(t0 time.Time) (res OpResult) {
+	if this.opTimeout <= 0 {
+		this.opCtx.t0 = t0
+		return this.behavior.Work(this.opCtx)
+	}
+
+	// An abandoned operation which never returns mustn't hold the
+	// client past the end of the run, or past its retirement; the
+	// behavior is closed once it does return (see close).
+	if this.pending != nil {
+		select {
+		case <-this.pending:
+			this.pending = nil
+		case <-this.ctx.Done():
+			return OpResult{Status: WRK_ERROR}
 		}
 	}
 
-	this.emitter.PublishResponseTime(this.id, usec, res)
-	return
+	behavior := this.behavior
+	w := this.workerOf(behavior)
+
+	w.ctx.t0 = t0
+	w.ctx.deadline = time.Now().Add(this.opTimeout)
+	if d, ok := this.ctx.Deadline(); ok && d.Before(w.ctx.deadline) {
+		w.ctx.deadline = d
+	}
+
+	if this.opTimer == nil {
+		this.opTimer = time.NewTimer(this.opTimeout)
+	} else {
+		this.opTimer.Reset(this.opTimeout)
+	}
+
+	defer stopTimer(this.opTimer)
+
+	w.work <- struct{}{}
+
+	err := context.DeadlineExceeded
+
+	select {
+	case u := <-w.done:
+		if u.err != nil {
+			panic(u.err)
+		}
+
+		// A result which only arrives once the operation has timed
+		// out, or once the run is over, still makes a timeout.  The
+		// outcome goes back for whoever waits on it.
+		if this.ctx.Err() == nil && time.Now().Before(w.ctx.deadline) {
+			return u.res
+		}
+
+		w.done <- u
+
+	case <-this.opTimer.C:
+
+	case <-this.ctx.Done():
+		err = this.ctx.Err()
+	}
+
+	// The worker is left with its operation, and its context.
+	w.ctx.cancel(err)
+	this.stopWorker()
+
+	// Once the run is over, there's no point in waiting for the
+	// operation, or in replacing the behavior.
+	if this.ctx.Err() != nil {
+		this.pending = w.done
+		return OpResult{Status: WRK_ERROR}
+	}
+
+	this.timeouts += 1
+
+	switch this.onTimeout {
+	case TIMEOUT_ABANDON:
+		this.pending = w.done
+
+	default:
+		this.closeWhenDone(behavior, w.done)
+		this.reinit()
+	}
+
+	return OpResult{Status: WRK_TIMEOUT}
+}
+
+// Stops a timer, so that it can be reset without firing early.
+func stopTimer(t *time.Timer) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+}
+
+// Closes a behavior once its abandoned operation returns.  The run
+// isn't over until it has been closed, so that fixtures are torn down
+// after it; but once the client is done, an operation which still
+// hasn't returned gets no more than BEHAVIOR_CLOSE_TIMEOUT, and its
+// behavior is left open.
+func (this *sandbox) closeWhenDone(behavior ContextBehavior, done <-chan *workOutcome) {
+	log := this.env.Log
+	this.wg.Add(1)
+
+	go func() {
+		defer this.wg.Done()
+		defer func() {
+			recover()
+		}()
+
+		select {
+		case <-done:
+		case <-this.ctx.Done():
+			select {
+			case <-done:
+			case <-time.After(BEHAVIOR_CLOSE_TIMEOUT):
+				log.Printf("abandoned operation still running after %s, not closing its behavior", BEHAVIOR_CLOSE_TIMEOUT)
+				return
+			}
+		}
+
+		closeBehavior(behavior)
+	}()
+}
+
+func closeBehavior(behavior ContextBehavior) {
+	ctx, cancel := context.WithTimeout(context.Background(), BEHAVIOR_CLOSE_TIMEOUT)
+	defer cancel()
+
+	behavior.Close(ctx)
 }
 
 func (this *sandbox) teardown() {
+	this.cancel()
 	this.close()
+
+	if atomic.LoadInt32(&this.released) == 1 {
+		this.metrics.release()
+	}
+
 	this.wg.Done()
 }
 
@@ -160,37 +673,27 @@ func (this *sandbox) close() (err error) {
 	defer func() {
 		e := recover()
 		if e != nil {
-			if u, ok := e.(error); ok {
-				err = u
-			}
+			err = asError(e)
 		}
 
 		return
 	}()
 
-	this.behavior.Close()
-	this.behavior = nil
-	return
-}
+	this.stopWorker()
 
-func (this *sandbox) parseProperties() (err error) {
-	props := this.props
-
-	const (
-		MinOpsPerStall = 100
-	)
-
-	if v, ok := props["internals.OpsPerStall"]; ok {
-		u, err := strconv.Atoi(v)
-		if err != nil || u < MinOpsPerStall {
-			return errors.New("internals.OpsPerStall must be >= 100 ops")
-		}
+	if this.behavior == nil {
+		return
+	}
 
-		this.stall = true
-		this.opsPerStall = u
-	} else {
-		this.stall = false
+	// Don't wait on an abandoned operation which may never return.
+	if this.pending != nil {
+		this.closeWhenDone(this.behavior, this.pending)
+		this.pending = nil
+		this.behavior = nil
+		return
 	}
 
+	closeBehavior(this.behavior)
+	this.behavior = nil
 	return
 }
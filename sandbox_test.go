@@ -1,10 +1,10 @@
-package main
+package knock
 
 import (
-	"log"
+	"context"
 	_ "math"
-	"strconv"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -20,27 +20,25 @@ func TestSandbox(t *testing.T) {
 	wg.Add(1)
 
 	tm := NewTaskMaster(&TaskMasterInfo{
-		WaitGroup:  wg,
-		Properties: make(map[string]string),
+		WaitGroup: wg,
 	})
 	tm.Start()
 
+	rec := NewRecorder(1, DEFAULT_HISTOGRAM_PRECISION)
+
 	sb := NewSandbox(&SandboxInfo{
-		Id: 1,
-		Properties: map[string]string{
-			"mongodb.run": "counters",
-			"mongodb.url": "mongodb://localhost:27017",
-		},
-		Duration:  15 * time.Second,
-		StartTime: t0,
-		Emitter:   tm,
-		WaitGroup: wg,
-		Factory:   func() Behavior { return &mongodb_behavior{} },
+		Id:         1,
+		Properties: make(map[string]string),
+		Duration:   15 * time.Second,
+		StartTime:  t0,
+		Emitter:    rec,
+		WaitGroup:  wg,
+		Factory:    Adapt(func() Behavior { return &dummy_behavior{sleep: 1 * time.Millisecond} }),
 	})
 
 	sb.Start()
 
-	countResponseTimes(tm)
+	countResponseTimes(tm, rec)
 
 	if time.Since(t0) < (15 * time.Second) {
 		t.Errorf("This test should have taken at least %d seconds.", 15)
@@ -48,94 +46,377 @@ func TestSandbox(t *testing.T) {
 	}
 }
 
-func TestSandboxWithMinWorkTime(t *testing.T) {
+type dummy_behavior struct {
+	sleep time.Duration
+}
+
+func (*dummy_behavior) Init(props map[string]string) (err error) {
+	return
+}
+
+func (*dummy_behavior) Close() {}
+
+func (this *dummy_behavior) Work(t0 time.Time) (res WorkResult) {
+	<-time.After(this.sleep)
+	return WRK_OK
+}
+
+func TestSandboxTimeouts(t *testing.T) {
 	const (
-		TestDuration  = 5 * time.Second
-		OpsPerStall   = 10000
-		SleepDuration = 5 * time.Microsecond
-		StallDuration = 1 * time.Second
+		TestDuration = 1 * time.Second
+		OpTimeout    = 10 * time.Millisecond
 	)
 
-	if testing.Short() {
-		t.Skip("skipping test in short mode.")
+	for _, policy := range []string{TIMEOUT_REINIT, TIMEOUT_ABANDON} {
+		t0 := time.Now()
+
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+
+		tm := NewTaskMaster(&TaskMasterInfo{
+			WaitGroup: wg,
+		})
+		tm.Start()
+
+		rec := NewRecorder(1, DEFAULT_HISTOGRAM_PRECISION)
+		inits := int32(0)
+
+		// The operations only return once they've timed out.
+		sb := NewSandbox(&SandboxInfo{
+			Id:         1,
+			Properties: make(map[string]string),
+			Duration:   TestDuration,
+			StartTime:  t0,
+			Emitter:    rec,
+			WaitGroup:  wg,
+			OpTimeout:  OpTimeout,
+			OnTimeout:  policy,
+			Factory: func() ContextBehavior {
+				atomic.AddInt32(&inits, 1)
+				return &blocking_behavior{}
+			},
+		})
+
+		sb.Start()
+
+		results := countResults(tm, rec)
+
+		if results[WRK_TIMEOUT] == 0 || results[WRK_OK] != 0 {
+			t.Errorf("%s: expected only timeouts, got: %v", policy, results)
+			return
+		}
+
+		// The last timeout may land after the end of the run.
+		if sb.timeouts-results[WRK_TIMEOUT] > 1 {
+			t.Errorf("%s: expected %d timeouts to be recorded, got: %d",
+				policy, sb.timeouts, results[WRK_TIMEOUT])
+			return
+		}
+
+		expected := 1
+		if policy == TIMEOUT_REINIT {
+			expected += sb.timeouts
+		}
+
+		if !expectInt(t, expected, int(atomic.LoadInt32(&inits))) {
+			return
+		}
 	}
+}
 
-	log.Printf("Running a %.2f second test...", TestDuration.Seconds())
+func TestSandboxReusesOperationContexts(t *testing.T) {
+	const TestDuration = 200 * time.Millisecond
 
-	t0 := time.Now()
+	for _, opTimeout := range []time.Duration{0, time.Second} {
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+
+		tm := NewTaskMaster(&TaskMasterInfo{
+			WaitGroup: wg,
+		})
+		tm.Start()
+
+		rec := NewRecorder(1, DEFAULT_HISTOGRAM_PRECISION)
+		b := &context_recording_behavior{}
+
+		sb := NewSandbox(&SandboxInfo{
+			Id:         1,
+			Properties: make(map[string]string),
+			Duration:   TestDuration,
+			StartTime:  time.Now(),
+			Emitter:    rec,
+			WaitGroup:  wg,
+			OpTimeout:  opTimeout,
+			Factory:    func() ContextBehavior { return b },
+		})
+
+		sb.Start()
+
+		countResults(tm, rec)
+
+		if len(b.starts) < 2 {
+			t.Errorf("%s: expected a few operations, got: %d", opTimeout, len(b.starts))
+			return
+		}
+
+		// Every operation gets the same context, with its own
+		// intended start time.
+		if !expectInt(t, 1, len(b.ctxs)) {
+			return
+		}
+
+		for i := 1; i < len(b.starts); i += 1 {
+			if !b.starts[i].After(b.starts[i-1]) {
+				t.Errorf("%s: expected a new intended start time for operation %d", opTimeout, i)
+				return
+			}
+		}
+	}
+}
+
+// Remembers the contexts and intended start times of its operations.
+type context_recording_behavior struct {
+	ctxs   map[context.Context]bool
+	starts []time.Time
+}
+
+func (*context_recording_behavior) Init(ctx context.Context, props map[string]string) (err error) {
+	return
+}
+
+func (*context_recording_behavior) Close(ctx context.Context) {}
+
+func (this *context_recording_behavior) Work(ctx context.Context) (res OpResult) {
+	if this.ctxs == nil {
+		this.ctxs = make(map[context.Context]bool)
+	}
+
+	this.ctxs[ctx] = true
+	this.starts = append(this.starts, IntendedStartTime(ctx))
+
+	<-time.After(time.Millisecond)
+	return OpResult{Status: WRK_OK}
+}
+
+func TestSandboxAbandonsHungOperations(t *testing.T) {
+	const (
+		TestDuration = 500 * time.Millisecond
+		OpTimeout    = 10 * time.Millisecond
+	)
 
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
 
 	tm := NewTaskMaster(&TaskMasterInfo{
-		WaitGroup:  wg,
-		Properties: make(map[string]string),
+		WaitGroup: wg,
 	})
 	tm.Start()
 
+	rec := NewRecorder(1, DEFAULT_HISTOGRAM_PRECISION)
+	release := make(chan struct{})
+
+	t0 := time.Now()
+
 	sb := NewSandbox(&SandboxInfo{
-		Id: 1,
-		Properties: map[string]string{
-			"mongodb.run":           "counters",
-			"mongodb.url":           "mongodb://localhost:27017",
-			"internals.OpsPerStall": strconv.Itoa(OpsPerStall),
-		},
-		Duration:  TestDuration,
-		StartTime: t0,
-		Emitter:   tm,
-		WaitGroup: wg,
-		Factory: func() Behavior {
-			return &dummy_behavior{
-				sleep: SleepDuration,
-			}
-		},
+		Id:         1,
+		Properties: make(map[string]string),
+		Duration:   TestDuration,
+		StartTime:  t0,
+		Emitter:    rec,
+		WaitGroup:  wg,
+		OpTimeout:  OpTimeout,
+		OnTimeout:  TIMEOUT_ABANDON,
+		Factory:    Adapt(func() Behavior { return &hanging_behavior{release: release} }),
 	})
 
 	sb.Start()
 
-	ops := countResponseTimes(tm)
+	done := make(chan map[WorkResult]int, 1)
+	go func() {
+		done <- countResults(tm, rec)
+	}()
 
-	if time.Since(t0) < TestDuration {
-		t.Errorf("This test should have taken at least %.1f seconds.", TestDuration.Seconds())
+	// The client stops on time, but the run waits for its behavior
+	// to be closed, once the hung operation returns.
+	select {
+	case <-sb.t.Dead():
+	case <-time.After(TestDuration + time.Second):
+		t.Fatal("expected the client to stop despite the hung operation")
+	}
+
+	if d := time.Since(t0); d > TestDuration+500*time.Millisecond {
+		t.Errorf("expected the client to stop on time, but it took %s", d)
 		return
 	}
 
-	// When the response times are very small (on the order of nanoseconds),
-	// then other channels aren't serviced as fairly by the Go scheduler
-	// (I think -- I'm certainly not seeing code associated with some channels
-	// run (e.g. IO)).  At those response times, the millisecond stall interval
-	// should dominate the ops/sec.  That is, performing OpsPerStall ops should
-	// take far far less time that performing the stall.  If we through out that
-	// term, then we can estimate the # of stalls, and put an upper bound on the
-	// number of ops.
-	expected_stalls := float64(TestDuration.Seconds()) / float64(StallDuration.Seconds())
-	if float64(sb.stalls) < expected_stalls {
-		t.Errorf("expected at least: %.4f stalls, observed: %d stalls",
-			expected_stalls, sb.stalls)
+	close(release)
+	results := <-done
+
+	if !expectInt(t, 1, results[WRK_OK]) {
 		return
 	}
 
-	// Add a 1% fudge factor to the upper bound because of error
-	// in the measurement of the actual duration of the test.
-	expected_max_ops := float64(OpsPerStall) * expected_stalls * 1.01
-	if float64(ops) > expected_max_ops {
-		t.Errorf("expected at most: %.4f ops, observed: %d ops",
-			expected_max_ops, ops)
+	if !expectInt(t, 1, results[WRK_TIMEOUT]) {
 		return
 	}
 }
 
-type dummy_behavior struct {
-	sleep time.Duration
+// Works once, then hangs until released, ignoring its timeout.
+type hanging_behavior struct {
+	ops     int
+	release chan struct{}
 }
 
-func (*dummy_behavior) Init(props map[string]string) (err error) {
+func (*hanging_behavior) Init(props map[string]string) (err error) {
 	return
 }
 
-func (*dummy_behavior) Close() {}
+func (*hanging_behavior) Close() {}
+
+func (this *hanging_behavior) Work(t0 time.Time) (res WorkResult) {
+	this.ops += 1
+	if this.ops > 1 {
+		<-this.release
+	}
 
-func (this *dummy_behavior) Work(t0 time.Time) (res WorkResult) {
-	<-time.After(this.sleep)
 	return WRK_OK
 }
+
+func TestSandboxCountsPanicsAsErrors(t *testing.T) {
+	const (
+		TestDuration = 500 * time.Millisecond
+		ReinitAfter  = 5
+	)
+
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+
+	tm := NewTaskMaster(&TaskMasterInfo{
+		WaitGroup: wg,
+	})
+	tm.Start()
+
+	rec := NewRecorder(1, DEFAULT_HISTOGRAM_PRECISION)
+	inits := 0
+
+	sb := NewSandbox(&SandboxInfo{
+		Id:          1,
+		Properties:  make(map[string]string),
+		Duration:    TestDuration,
+		StartTime:   time.Now(),
+		Emitter:     rec,
+		WaitGroup:   wg,
+		ReinitAfter: ReinitAfter,
+		Factory: Adapt(func() Behavior {
+			inits += 1
+			return &flaky_behavior{failEvery: 1, panicEvery: 3}
+		}),
+	})
+
+	sb.Start()
+
+	results := countResults(tm, rec)
+
+	if results[WRK_OK] != 0 || results[WRK_ERROR] == 0 {
+		t.Errorf("expected only errors, got: %v", results)
+		return
+	}
+
+	if sb.panics == 0 {
+		t.Error("expected some panics")
+		return
+	}
+
+	// The last few errors may land after the end of the run.
+	if d := results[WRK_ERROR]/ReinitAfter - sb.reinits; d < -1 || d > 0 {
+		t.Errorf("expected about %d reinits, got: %d", results[WRK_ERROR]/ReinitAfter, sb.reinits)
+		return
+	}
+
+	if !expectInt(t, 1+sb.reinits, inits) {
+		return
+	}
+}
+
+// Fails every few operations, sometimes by panicking with a value
+// which isn't an error.
+type flaky_behavior struct {
+	ops        int
+	failEvery  int
+	panicEvery int
+}
+
+func (*flaky_behavior) Init(props map[string]string) (err error) {
+	return
+}
+
+func (*flaky_behavior) Close() {}
+
+func (this *flaky_behavior) Work(t0 time.Time) (res WorkResult) {
+	this.ops += 1
+	<-time.After(100 * time.Microsecond)
+
+	switch {
+	case this.panicEvery > 0 && this.ops%this.panicEvery == 0:
+		panic("flaky")
+	case this.failEvery > 0 && this.ops%this.failEvery == 0:
+		return WRK_ERROR
+	default:
+		return WRK_OK
+	}
+}
+
+func TestSandboxCancelsOperationsInFlight(t *testing.T) {
+	const (
+		TestDuration = 300 * time.Millisecond
+		OpTimeout    = 20 * time.Millisecond
+	)
+
+	for _, opTimeout := range []time.Duration{0, OpTimeout} {
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+
+		tm := NewTaskMaster(&TaskMasterInfo{
+			WaitGroup: wg,
+		})
+		tm.Start()
+
+		rec := NewRecorder(1, DEFAULT_HISTOGRAM_PRECISION)
+		t0 := time.Now()
+
+		sb := NewSandbox(&SandboxInfo{
+			Id:         1,
+			Properties: make(map[string]string),
+			Duration:   TestDuration,
+			StartTime:  t0,
+			Emitter:    rec,
+			WaitGroup:  wg,
+			OpTimeout:  opTimeout,
+			Factory:    func() ContextBehavior { return &blocking_behavior{} },
+		})
+
+		sb.Start()
+
+		results := countResults(tm, rec)
+
+		// The operation in flight at the end of the run is
+		// cancelled, rather than waited for.
+		if d := time.Since(t0); d > TestDuration+time.Second {
+			t.Errorf("%s: expected the run to end on time, but it took %s", opTimeout, d)
+			return
+		}
+
+		// With an operation timeout, every operation times out;
+		// without one, the only operation is cut short by the end
+		// of the run, and isn't recorded.
+		if opTimeout > 0 && (results[WRK_TIMEOUT] == 0 || results[WRK_ERROR] != 0) {
+			t.Errorf("%s: expected only timeouts, got: %v", opTimeout, results)
+			return
+		}
+
+		if opTimeout == 0 && results[WRK_OK]+results[WRK_ERROR]+results[WRK_TIMEOUT] != 0 {
+			t.Errorf("%s: expected no results, got: %v", opTimeout, results)
+			return
+		}
+	}
+}
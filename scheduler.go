@@ -0,0 +1,196 @@
+package knock
+
+import (
+	"errors"
+	"launchpad.net/tomb"
+	"math/rand"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	ARRIVAL_FIXED   = "fixed"
+	ARRIVAL_POISSON = "poisson"
+
+	DEFAULT_ARRIVAL_QUEUE_SIZE = 1024
+
+	// An operation which starts more than this long after its
+	// intended start time is counted as late.
+	ARRIVAL_LATE_THRESHOLD = 1 * time.Millisecond
+)
+
+type SchedulerInfo struct {
+	Rate       float64
+	Arrival    string
+	Duration   time.Duration
+	StartTime  time.Time
+	Properties map[string]string
+}
+
+// The scheduler drives an open-loop benchmark.  Instead of each
+// sandbox issuing its next operation as soon as the previous one
+// returns, the scheduler publishes intended start times on a fixed
+// or Poisson arrival schedule, and the sandboxes act as a worker
+// pool which drains them.  Arrivals which cannot be queued because
+// every worker is busy (and the queue is full) are dropped.
+type scheduler struct {
+	t         tomb.Tomb
+	ch        chan time.Time
+	rng       *rand.Rand
+	rate      float64
+	arrival   string
+	d         time.Duration
+	t0        time.Time
+	props     map[string]string
+	queueSize int
+
+	scheduled int64
+	late      int64
+	dropped   int64
+}
+
+func NewScheduler(info *SchedulerInfo) *scheduler {
+	this := &scheduler{
+		rng:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		rate:      info.Rate,
+		arrival:   info.Arrival,
+		d:         info.Duration,
+		t0:        info.StartTime,
+		props:     info.Properties,
+		queueSize: DEFAULT_ARRIVAL_QUEUE_SIZE,
+	}
+
+	// Config.Validate has already rejected a bad queue size.
+	this.parseProperties(this.props)
+
+	this.ch = make(chan time.Time, this.queueSize)
+	return this
+}
+
+func (this *scheduler) Start() {
+	go this.loop()
+}
+
+func (this *scheduler) Stop() (err error) {
+	this.t.Kill(nil)
+	return this.t.Wait()
+}
+
+// Intended start times of the scheduled operations.  The channel
+// is closed once the run is over.
+func (this *scheduler) Arrivals() <-chan time.Time {
+	return this.ch
+}
+
+func (this *scheduler) markLate() {
+	atomic.AddInt64(&this.late, 1)
+}
+
+func (this *scheduler) markDropped() {
+	atomic.AddInt64(&this.dropped, 1)
+}
+
+func (this *scheduler) loop() {
+	defer this.t.Done()
+	defer this.shutdown()
+
+	next := this.t0
+	end := this.t0.Add(this.d)
+	timer := time.NewTimer(next.Sub(time.Now()))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-this.t.Dying():
+			return
+
+		case now := <-timer.C:
+			// Issue every arrival that has come due, so that the
+			// schedule catches up if the timer fired late.
+			for !next.After(now) {
+				if !next.Before(end) {
+					return
+				}
+
+				this.issue(next)
+				next = next.Add(this.interval())
+			}
+
+			timer.Reset(next.Sub(time.Now()))
+		}
+	}
+}
+
+func (this *scheduler) issue(t0 time.Time) {
+	atomic.AddInt64(&this.scheduled, 1)
+
+	select {
+	case this.ch <- t0:
+	default:
+		this.markDropped()
+	}
+}
+
+func (this *scheduler) interval() time.Duration {
+	mean := float64(time.Second) / this.rate
+
+	switch this.arrival {
+	case ARRIVAL_POISSON:
+		return time.Duration(this.rng.ExpFloat64() * mean)
+	default:
+		return time.Duration(mean)
+	}
+}
+
+func (this *scheduler) shutdown() {
+	// Anything still queued when the run ends never got to run.
+	for {
+		select {
+		case <-this.ch:
+			this.markDropped()
+		default:
+			close(this.ch)
+			return
+		}
+	}
+}
+
+func (this *scheduler) parseProperties(props map[string]string) (err error) {
+	w, err := parseArrivalQueueSize(props)
+	if err != nil {
+		return
+	}
+
+	this.queueSize = w
+	return
+}
+
+func parseArrivalQueueSize(props map[string]string) (size int, err error) {
+	v, ok := props["internals.ArrivalQueueSize"]
+	if !ok {
+		return DEFAULT_ARRIVAL_QUEUE_SIZE, nil
+	}
+
+	size, err = strconv.Atoi(v)
+	if err != nil || size < 1 {
+		return 0, errors.New("internals.ArrivalQueueSize must be >= 1")
+	}
+
+	return
+}
+
+type ScheduleResult struct {
+	Scheduled int64
+	Late      int64
+	Dropped   int64
+}
+
+// Only meaningful after the scheduler is dead.
+func (this *scheduler) Result() *ScheduleResult {
+	return &ScheduleResult{
+		Scheduled: atomic.LoadInt64(&this.scheduled),
+		Late:      atomic.LoadInt64(&this.late),
+		Dropped:   atomic.LoadInt64(&this.dropped),
+	}
+}
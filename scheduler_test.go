@@ -0,0 +1,100 @@
+package knock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedulerFixedRate(t *testing.T) {
+	const (
+		Rate         = 200
+		TestDuration = 1 * time.Second
+	)
+
+	sched := NewScheduler(&SchedulerInfo{
+		Rate:       Rate,
+		Arrival:    ARRIVAL_FIXED,
+		Duration:   TestDuration,
+		StartTime:  time.Now(),
+		Properties: make(map[string]string),
+	})
+	sched.Start()
+
+	count := 0
+	for _ = range sched.Arrivals() {
+		count += 1
+	}
+
+	res := sched.Result()
+
+	if !expectInt(t, Rate, int(res.Scheduled)) {
+		return
+	}
+
+	if !expectInt(t, Rate, count) {
+		return
+	}
+
+	if !expectInt(t, 0, int(res.Dropped)) {
+		return
+	}
+}
+
+func TestSchedulerDropsWhenQueueIsFull(t *testing.T) {
+	const (
+		Rate         = 100
+		QueueSize    = 10
+		TestDuration = 500 * time.Millisecond
+	)
+
+	sched := NewScheduler(&SchedulerInfo{
+		Rate:      Rate,
+		Arrival:   ARRIVAL_POISSON,
+		Duration:  TestDuration,
+		StartTime: time.Now(),
+		Properties: map[string]string{
+			"internals.ArrivalQueueSize": "10",
+		},
+	})
+	sched.Start()
+
+	// Nobody is draining the queue, so every arrival is dropped
+	// either when it is issued or when the run ends.
+	if err := sched.t.Wait(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	res := sched.Result()
+
+	if res.Scheduled <= QueueSize {
+		t.Errorf("expected more than %d scheduled ops, got: %d", QueueSize, res.Scheduled)
+		return
+	}
+
+	if !expectInt(t, int(res.Scheduled), int(res.Dropped)) {
+		return
+	}
+}
+
+func TestSchedulerProperties(t *testing.T) {
+	sched := &scheduler{}
+	props := make(map[string]string)
+
+	err := sched.parseProperties(props)
+	if !expectOk(t, err) {
+		return
+	}
+
+	if !expectInt(t, DEFAULT_ARRIVAL_QUEUE_SIZE, sched.queueSize) {
+		return
+	}
+
+	props["internals.ArrivalQueueSize"] = "0"
+
+	err = sched.parseProperties(props)
+	if err == nil {
+		t.Error("expected an error when internals.ArrivalQueueSize < 1")
+		return
+	}
+}
@@ -5,12 +5,12 @@ h = {}
 ARGF.each do |line|
   line.strip!.tr!("\t", '')
 
-  m = /^\s*(.*):\s*(\d+(\.\d+)?)(μs)?$/.match(line)
+  m = /^\s*(.*):\s*(\d+(\.\d+)?)(ns|μs|ms|s)?$/.match(line)
   if m
     k = case m[1]
         when "Run Time (s)"; "Time"
         when "Throughput (ops/sec)"; "Tput"
-        when "Mean Response Time (μs)"; next
+        when "Mean Response Time"; next
         when "Load Efficiency (%)"; "Efcy"
         when "5th Percentile"; "0.05"
         when "95th Percentile"; "0.95"
@@ -18,7 +18,9 @@ ARGF.each do |line|
         else m[1]
         end
 
-    h[k] = Float(m[2])
+    # Times are compared in microseconds, whatever unit they're shown in.
+    scale = { "ns" => 0.001, "μs" => 1, "ms" => 1000, "s" => 1000000 }
+    h[k] = Float(m[2]) * scale.fetch(m[4], 1)
   end
 end
 
@@ -1,4 +1,4 @@
-package main
+package knock
 
 import (
 	"log"
@@ -12,7 +12,7 @@ func spawnTask(emitter LatencyEmitter, wg *sync.WaitGroup, count int) {
 		log.Print("test task starting")
 
 		for i := 0; i < count; i += 1 {
-			emitter.PublishResponseTime(-1, int64(i), WRK_OK)
+			emitter.PublishResponseTime(-1, time.Duration(i), OpResult{Status: WRK_OK})
 			<-time.After(25 * time.Millisecond)
 		}
 
@@ -22,21 +22,28 @@ func spawnTask(emitter LatencyEmitter, wg *sync.WaitGroup, count int) {
 	}()
 }
 
-func countResponseTimes(tm *taskmaster) (count int) {
-	c := 0
-	for {
-		select {
-		case <-tm.t.Dead():
-			return c
-		case _, ok := <-tm.ResponseTimes():
-			// If we don't check whether the channel is closed,
-			// then the count will sometimes be off (high).
-			if !ok {
-				break
-			}
-			c += 1
-		}
+// Waits for the taskmaster to die, then tallies the results that
+// were recorded in the meantime.
+func countResults(tm *taskmaster, rec *recorder) (results map[WorkResult]int) {
+	<-tm.t.Dead()
+
+	s := rec.swap(newShard(DEFAULT_HISTOGRAM_PRECISION))
+
+	results = make(map[WorkResult]int)
+	for res, count := range s.errors {
+		results[res] = count
+	}
+
+	results[WRK_OK] = int(s.ops)
+	return
+}
+
+func countResponseTimes(tm *taskmaster, rec *recorder) (count int) {
+	for _, c := range countResults(tm, rec) {
+		count += c
 	}
+
+	return
 }
 
 func TestTaskMaster(t *testing.T) {
@@ -48,14 +55,14 @@ func TestTaskMaster(t *testing.T) {
 	wg.Add(1)
 
 	tm := NewTaskMaster(&TaskMasterInfo{
-		WaitGroup:  wg,
-		Properties: make(map[string]string),
+		WaitGroup: wg,
 	})
 	tm.Start()
 
-	spawnTask(tm, wg, 50)
+	rec := NewRecorder(0, DEFAULT_HISTOGRAM_PRECISION)
+	spawnTask(rec, wg, 50)
 
-	c := countResponseTimes(tm)
+	c := countResponseTimes(tm, rec)
 
 	if !expectInt(t, 50, c) {
 		return
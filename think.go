@@ -0,0 +1,95 @@
+package knock
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+const (
+	THINK_CONSTANT    = "const"
+	THINK_UNIFORM     = "uniform"
+	THINK_EXPONENTIAL = "exp"
+	THINK_NORMAL      = "normal"
+)
+
+// The distribution of the pauses a client takes between operations,
+// e.g.
+//
+//   5ms                 always 5ms
+//   uniform:5ms,15ms    anywhere between 5ms and 15ms
+//   exp:10ms            exponentially distributed with a 10ms mean
+//   normal:10ms,2ms     normally distributed with a 10ms mean and a
+//                       2ms standard deviation (never less than 0)
+type thinkTime struct {
+	spec string
+	kind string
+	a    time.Duration
+	b    time.Duration
+}
+
+func parseThinkTime(spec string) (this *thinkTime, err error) {
+	this = &thinkTime{spec: spec, kind: THINK_CONSTANT}
+
+	args := spec
+	if i := strings.Index(spec, ":"); i >= 0 {
+		this.kind, args = spec[:i], spec[i+1:]
+	}
+
+	ds := strings.Split(args, ",")
+
+	switch this.kind {
+	case THINK_CONSTANT, THINK_EXPONENTIAL:
+		if len(ds) != 1 {
+			return nil, fmt.Errorf("bad think time %q, expected: %s:DURATION", spec, this.kind)
+		}
+
+	case THINK_UNIFORM, THINK_NORMAL:
+		if len(ds) != 2 {
+			return nil, fmt.Errorf("bad think time %q, expected: %s:DURATION,DURATION", spec, this.kind)
+		}
+
+	default:
+		return nil, fmt.Errorf("bad think time %q, must be one of const, uniform, exp, normal", spec)
+	}
+
+	this.a, err = time.ParseDuration(strings.TrimSpace(ds[0]))
+	if err == nil && len(ds) > 1 {
+		this.b, err = time.ParseDuration(strings.TrimSpace(ds[1]))
+	}
+
+	if err != nil || this.a < 0 || this.b < 0 {
+		return nil, fmt.Errorf("bad think time %q", spec)
+	}
+
+	if this.kind == THINK_UNIFORM && this.b < this.a {
+		return nil, fmt.Errorf("bad think time %q, the minimum is larger than the maximum", spec)
+	}
+
+	return
+}
+
+// Draws the next pause.
+func (this *thinkTime) next(rng *rand.Rand) (d time.Duration) {
+	switch this.kind {
+	case THINK_UNIFORM:
+		d = this.a + time.Duration(rng.Int63n(int64(this.b-this.a)+1))
+	case THINK_EXPONENTIAL:
+		d = time.Duration(rng.ExpFloat64() * float64(this.a))
+	case THINK_NORMAL:
+		d = this.a + time.Duration(rng.NormFloat64()*float64(this.b))
+	default:
+		d = this.a
+	}
+
+	if d < 0 {
+		d = 0
+	}
+
+	return
+}
+
+func (this *thinkTime) String() string {
+	return this.spec
+}
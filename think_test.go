@@ -0,0 +1,63 @@
+package knock
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestParseThinkTime(t *testing.T) {
+	expectations := []struct {
+		spec string
+		kind string
+		a    time.Duration
+		b    time.Duration
+	}{
+		{"5ms", THINK_CONSTANT, 5 * time.Millisecond, 0},
+		{"uniform:5ms,15ms", THINK_UNIFORM, 5 * time.Millisecond, 15 * time.Millisecond},
+		{"exp:10ms", THINK_EXPONENTIAL, 10 * time.Millisecond, 0},
+		{"normal:10ms, 2ms", THINK_NORMAL, 10 * time.Millisecond, 2 * time.Millisecond},
+	}
+
+	for _, e := range expectations {
+		tt, err := parseThinkTime(e.spec)
+		if !expectOk(t, err) {
+			return
+		}
+
+		if !expectString(t, e.kind, tt.kind) {
+			return
+		}
+
+		if tt.a != e.a || tt.b != e.b {
+			t.Errorf("%s: expected: %s,%s, got: %s,%s", e.spec, e.a, e.b, tt.a, tt.b)
+			return
+		}
+	}
+
+	for _, spec := range []string{"", "soon", "exp:1ms,2ms", "uniform:5ms", "uniform:15ms,5ms", "gamma:1ms", "-5ms"} {
+		if _, err := parseThinkTime(spec); err == nil {
+			t.Errorf("expected an error for think time %q", spec)
+			return
+		}
+	}
+}
+
+func TestThinkTimeStaysInRange(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	uniform, _ := parseThinkTime("uniform:5ms,15ms")
+	normal, _ := parseThinkTime("normal:1ms,10ms")
+
+	for i := 0; i < 1000; i++ {
+		if d := uniform.next(rng); d < 5*time.Millisecond || d > 15*time.Millisecond {
+			t.Errorf("expected a think time between 5ms and 15ms, got: %s", d)
+			return
+		}
+
+		if d := normal.next(rng); d < 0 {
+			t.Errorf("expected a non-negative think time, got: %s", d)
+			return
+		}
+	}
+}
@@ -1,9 +1,78 @@
-package main
+package knock
 
 const (
 	/*
 	 CHANGES
 
+	 1.2.0:
+	   * added an open-loop mode (--rate, --arrival) which issues
+	     operations on a fixed or Poisson arrival schedule and
+	     reports late and dropped operations
+	   * added --warmup and --cooldown phases which run the
+	     behavior, but are excluded from the statistics
+	   * added load profiles (--profile) which ramp, step, spike
+	     and hold the number of clients over the run
+	   * added -n/--ops and --client-ops, to stop after a number
+	     of successful operations rather than a duration
+	   * the first interrupt stops the run gracefully and still
+	     prints the full report; a second one exits at once
+	   * added per-operation timeouts (--op-timeout), counted as
+	     WRK_TIMEOUT, after which a client re-initializes its
+	     behavior or abandons the operation (--on-timeout)
+	   * reported the response times of failed and timed-out
+	     operations separately from the successful ones
+	   * behavior panics are counted as errors rather than
+	     crashing the run; --reinit-after re-initializes a
+	     failing behavior, and --max-errors and --max-error-rate
+	     abort a run which fails too often
+	   * each client records its statistics in its own shard,
+	     merged once per progress interval, rather than sending
+	     an event per operation over a channel
+	   * removed the internals.OpsPerStall property, which is now
+	     ignored
+	   * added think times (--think) drawn from a fixed, uniform,
+	     exponential or normal distribution, and pacing (--pace)
+	   * added --sweep, which runs one round per load level and
+	     reports throughput against response time, and the knee
+	     of the curve
+	   * split the engine into an importable package with a
+	     knock.Run entry point; the command moved to cmd/knock
+	   * added a behavior registry, --behavior to choose one, and
+	     "knock behaviors" to list them
+	   * added ContextBehavior, whose operations are cancelled at
+	     their timeout and at the end of the run
+	   * added a per-client Env with a seeded random source (--seed),
+	     a logger and state shared between clients
+	   * added OpResult, so that behaviors can count the bytes
+	     they transfer, and bandwidth to the reports
+	   * added labels to OpResult, with statistics for each type
+	     of operation
+	   * added behavior metrics (counters, gauges and histograms)
+	     to the Env, and a "Behavior Metrics" report section
+	   * added Fixture, to set up before a run and tear down after
+	     it; the MongoDB behavior plants its document once, and can
+	     drop its collection (mongodb.drop)
+	   * added client groups (--group), each with its own
+	     properties or behavior, and a report section
+	   * added knock.Mix, a weighted mix of behaviors within each
+	     client, and a MongoDB "reads" experiment and "mix" run
+	   * replaced the latency maps with HDR-style histograms of
+	     configurable precision (--precision), which answer any
+	     percentile; p95 and p99 are no longer skipped when they
+	     share a bucket
+	   * added --percentiles to choose the percentiles in the
+	     reports, the median, standard deviation and coefficient of
+	     variation, and a rolling percentile in the progress
+	     summaries (--summary-percentile)
+	   * response times are measured in nanoseconds rather than
+	     truncated to microseconds, and the reports choose their
+	     units
+	   * added an optional coordinated-omission correction for
+	     closed-loop runs (--expected-interval), reported next to
+	     the measured response times
+	   * added a per-interval timeline to the report, and
+	     --timeline to write it to a CSV file
+
 	 1.1.1:
 	   * added "internals.OpsPerStall" property to insert a 1s
 	     pause into every sandbox after this many operations.
@@ -19,5 +88,5 @@ const (
 	     MongoDB which performs increments of counters on a
 	     single document
 	*/
-	VERSION = "1.1.1"
+	VERSION = "1.2.0"
 )